@@ -3,6 +3,15 @@
 
 package bimap
 
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
 // Speical constants that may be returned from certain methods that
 // access a Map.
 const (
@@ -14,11 +23,57 @@ const (
 type Map struct {
 	strToInt map[string]int32
 	intToStr []string
+	// Whether Add is forbidden to insert new strings
+	frozen bool
+	// The id returned by FindByStringOrUnknown on a miss
+	unknown int32
+	// Applied to strings before they are added or looked up; may be nil
+	normalize func(string) string
 }
 
 // New creates an empty Map
 func New() *Map {
-	return &Map{make(map[string]int32), make([]string, 0, 1024)}
+	return newMap(1024, 0)
+}
+
+// NewWithCapacity creates an empty Map with room for n strings, which
+// avoids reallocations when the size of the map is known in advance.
+func NewWithCapacity(n int) *Map {
+	return newMap(n, n)
+}
+
+// NewNormalized creates an empty Map that applies f to every string
+// before adding it (so the normalized form is stored) or looking it up
+// with Add, FindByString, FindByStringOrUnknown, AppendByString and
+// TranslateByString. FindByInt is not affected.
+func NewNormalized(f func(string) string) *Map {
+	m := New()
+	m.normalize = f
+	return m
+}
+
+// NewWithReserved creates a Map where the strings in special get the
+// ids 0 to len(special)-1 in order (e.g. for padding and unknown
+// tokens), ahead of any string added later. It panics when special
+// contains a duplicate or an empty string.
+func NewWithReserved(special []string) *Map {
+	m := New()
+	for i, s := range special {
+		if m.Add(s) != int32(i) {
+			panic("trying to reserve a duplicate string")
+		}
+	}
+	return m
+}
+
+// newMap creates an empty Map with the given capacities of the slice
+// and the map. All constructors go through this.
+func newMap(sliceCap, mapCap int) *Map {
+	return &Map{
+		strToInt: make(map[string]int32, mapCap),
+		intToStr: make([]string, 0, sliceCap),
+		unknown:  NoInt,
+	}
 }
 
 // FromSlice creates an empty Map from the given slice
@@ -30,14 +85,36 @@ func FromSlice(s []string) *Map {
 	return m
 }
 
+// Copy creates a deep copy of the map, so that adding to or deleting
+// from one does not affect the other. The frozen state, the unknown
+// string and the normalizer are copied too.
+func (m *Map) Copy() *Map {
+	c := newMap(len(m.intToStr), len(m.strToInt))
+	c.intToStr = append(c.intToStr, m.intToStr...)
+	for s, i := range m.strToInt {
+		c.strToInt[s] = i
+	}
+	c.frozen = m.frozen
+	c.unknown = m.unknown
+	c.normalize = m.normalize
+	return c
+}
+
 // Add adds the given string into the map and returns its id. The
-// string being added should not be empty. This is not thread safe.
+// string being added should not be empty. When the map is frozen, the
+// string must already be in the map. This is not thread safe.
 func (m *Map) Add(s string) int32 {
+	if m.normalize != nil {
+		s = m.normalize(s)
+	}
 	if len(s) == 0 {
 		panic("trying to add an empty string")
 	}
 	i, ok := m.strToInt[s]
 	if !ok {
+		if m.frozen {
+			panic("trying to add a new string to a frozen map")
+		}
 		i = int32(len(m.intToStr))
 		m.strToInt[s] = i
 		m.intToStr = append(m.intToStr, s)
@@ -45,9 +122,26 @@ func (m *Map) Add(s string) int32 {
 	return i
 }
 
+// Freeze makes the map read-only: afterwards Add (and thus
+// AppendByString and TranslateByString) panics on a string not in the
+// map, and Delete panics, so that a map shared for lookups is never
+// modified by accident. Strings already in the map can still be
+// "added" to get their ids.
+func (m *Map) Freeze() {
+	m.frozen = true
+}
+
+// Frozen tells whether the map has been frozen.
+func (m *Map) Frozen() bool {
+	return m.frozen
+}
+
 // FindByString finds the id or returns NoInt if the string is not in
 // the map.
 func (m *Map) FindByString(s string) int32 {
+	if m.normalize != nil {
+		s = m.normalize(s)
+	}
 	i, ok := m.strToInt[s]
 	if ok {
 		return i
@@ -55,6 +149,54 @@ func (m *Map) FindByString(s string) int32 {
 	return NoInt
 }
 
+// Find is like FindByString but reports whether s is in the map
+// instead of returning NoInt on a miss.
+func (m *Map) Find(s string) (int32, bool) {
+	if m.normalize != nil {
+		s = m.normalize(s)
+	}
+	i, ok := m.strToInt[s]
+	return i, ok
+}
+
+// FindInt is like FindByInt but reports whether i is in the map
+// instead of returning an empty string on a miss.
+func (m *Map) FindInt(i int32) (string, bool) {
+	if 0 <= i && i < int32(len(m.intToStr)) {
+		return m.intToStr[i], true
+	}
+	return "", false
+}
+
+// Contains tests if s is in the map without adding it.
+func (m *Map) Contains(s string) bool {
+	return m.FindByString(s) != NoInt
+}
+
+// ContainsInt tests if i is a valid id in the map.
+func (m *Map) ContainsInt(i int32) bool {
+	return 0 <= i && i < int32(len(m.intToStr))
+}
+
+// SetUnknown adds s to the map (see Add) and makes its id the one
+// returned by FindByStringOrUnknown for strings not in the map.
+func (m *Map) SetUnknown(s string) {
+	m.unknown = m.Add(s)
+}
+
+// FindByStringOrUnknown is like FindByString but returns the id of the
+// unknown string set by SetUnknown on a miss. It returns NoInt when
+// no unknown string has been set.
+func (m *Map) FindByStringOrUnknown(s string) int32 {
+	if m.normalize != nil {
+		s = m.normalize(s)
+	}
+	if i, ok := m.strToInt[s]; ok {
+		return i
+	}
+	return m.unknown
+}
+
 // FindByInt finds the string corresponding to the given integral
 // id. Returns the string if the id is in the map; or an empty string
 // if it is not.
@@ -73,6 +215,29 @@ func (m *Map) AppendByString(strs []string, ints *[]int32) {
 	}
 }
 
+// Equal tests if two maps have the same size and map every id to the
+// same string. The frozen state, the unknown string and the
+// normalizer are ignored.
+func (m *Map) Equal(other *Map) bool {
+	if len(m.intToStr) != len(other.intToStr) {
+		return false
+	}
+	for i, s := range m.intToStr {
+		if other.intToStr[i] != s {
+			return false
+		}
+	}
+	return true
+}
+
+// AddAll adds every string in strs to the Map (see Add), discarding
+// the ids.
+func (m *Map) AddAll(strs []string) {
+	for _, s := range strs {
+		m.Add(s)
+	}
+}
+
 // TranslateByString translates a slice of string into a slice of
 // integers. New words are also added to the Map.
 func (m *Map) TranslateByString(strs []string) []int32 {
@@ -106,3 +271,211 @@ func (m *Map) TranslateByInt(ints []int32) []string {
 func (m *Map) Size() int32 {
 	return int32(len(m.intToStr))
 }
+
+// Range calls f with every id and string in ascending id order until
+// f returns false. The behavior is undefined if the map is modified
+// during the iteration.
+func (m *Map) Range(f func(id int32, s string) bool) {
+	for i, s := range m.intToStr {
+		if !f(int32(i), s) {
+			return
+		}
+	}
+}
+
+// Merge adds every string of other into m in id order and returns
+// the mapping from the ids in other to the ids in m. Strings already
+// in m keep their ids. This is not thread safe.
+func (m *Map) Merge(other *Map) []int32 {
+	otherToM := make([]int32, len(other.intToStr))
+	for i, s := range other.intToStr {
+		otherToM[i] = m.Add(s)
+	}
+	return otherToM
+}
+
+// Delete removes the given strings (those not in the map are ignored)
+// and assigns the remaining ones new dense ids, keeping their relative
+// order. It returns the mapping from old ids to new ids, where removed
+// strings are mapped to NoInt. When the unknown string is removed, no
+// unknown string is set afterwards. It panics when the map is frozen.
+func (m *Map) Delete(strs []string) []int32 {
+	keep := make([]bool, len(m.intToStr))
+	for i := range keep {
+		keep[i] = true
+	}
+	for _, s := range strs {
+		if i := m.FindByString(s); i != NoInt {
+			keep[i] = false
+		}
+	}
+	return m.compact(keep)
+}
+
+// compact removes the entries not marked in keep and assigns the rest
+// new dense ids in the original order. It returns the mapping from
+// old ids to new ids, where removed entries are mapped to NoInt. The
+// unknown id is remapped as well. It panics when the map is frozen.
+func (m *Map) compact(keep []bool) []int32 {
+	if m.frozen {
+		panic("trying to remove strings from a frozen map")
+	}
+	oldToNew := make([]int32, len(m.intToStr))
+	w := 0
+	for i, s := range m.intToStr {
+		if keep[i] {
+			oldToNew[i] = int32(w)
+			m.intToStr[w] = s
+			m.strToInt[s] = int32(w)
+			w++
+		} else {
+			oldToNew[i] = NoInt
+			delete(m.strToInt, s)
+		}
+	}
+	for i := w; i < len(m.intToStr); i++ {
+		m.intToStr[i] = ""
+	}
+	m.intToStr = m.intToStr[:w]
+	if m.unknown != NoInt {
+		m.unknown = oldToNew[m.unknown]
+	}
+	return oldToNew
+}
+
+// BadFormat is returned by ReadFrom when the input is not a valid
+// serialized Map.
+var BadFormat = errors.New("malformed serialized map")
+
+// countingWriter counts the bytes that are successfully written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// WriteTo serializes the map to w in id order: the number of entries
+// followed by each string, all prefixed by their lengths as
+// uvarints. It returns the number of bytes written to w and any error
+// from w.
+func (m *Map) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	var buf [binary.MaxVarintLen64]byte
+	k := binary.PutUvarint(buf[:], uint64(len(m.intToStr)))
+	bw.Write(buf[:k])
+	for _, s := range m.intToStr {
+		k = binary.PutUvarint(buf[:], uint64(len(s)))
+		bw.Write(buf[:k])
+		if _, err := bw.WriteString(s); err != nil {
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom reads a map serialized by WriteTo from r. The ids of the
+// strings are the same as in the serialized map. When r is not an
+// io.ByteReader, it is buffered and may be read past the end of the
+// map. It returns BadFormat when the input is malformed (e.g. with
+// an empty or a duplicate string), io.ErrUnexpectedEOF when it ends
+// in the middle of the map or any other error from r.
+func ReadFrom(r io.Reader) (*Map, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		r, br = b, b
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > 1<<31-1 {
+		return nil, BadFormat
+	}
+	m := New()
+	var buf bytes.Buffer
+	for i := uint64(0); i < size; i++ {
+		length, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if length == 0 || length > 1<<31-1 {
+			return nil, BadFormat
+		}
+		// Let buf grow with the data actually read rather than trusting
+		// length to allocate upfront.
+		buf.Reset()
+		if _, err := io.CopyN(&buf, r, int64(length)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		s := buf.String()
+		if _, ok := m.strToInt[s]; ok {
+			return nil, BadFormat
+		}
+		m.Add(s)
+	}
+	return m, nil
+}
+
+// NewlineInString is returned by WriteText when a string cannot be
+// written on a single line.
+var NewlineInString = errors.New("string contains a newline")
+
+// WriteText writes the map to w in id order, one string per line. It
+// returns NewlineInString without writing anything when some string
+// contains a newline.
+func (m *Map) WriteText(w io.Writer) error {
+	for _, s := range m.intToStr {
+		if strings.IndexByte(s, '\n') >= 0 {
+			return NewlineInString
+		}
+	}
+	bw := bufio.NewWriter(w)
+	for _, s := range m.intToStr {
+		bw.WriteString(s)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadText reads a map written by WriteText from r, where the id of
+// each string is its line number starting from 0. The last line may
+// lack a trailing newline. It returns BadFormat when there is an empty
+// or a duplicate line.
+func ReadText(r io.Reader) (*Map, error) {
+	br := bufio.NewReader(r)
+	m := New()
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			return m, nil
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return nil, BadFormat
+		}
+		if _, ok := m.strToInt[line]; ok {
+			return nil, BadFormat
+		}
+		m.Add(line)
+		if err == io.EOF {
+			return m, nil
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package bimap
 
 import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -78,3 +84,522 @@ func TestMap(t *testing.T) {
 		m.Add("")
 	}()
 }
+
+func TestNewWithReserved(t *testing.T) {
+	special := []string{"<pad>", "<unk>", "<s>"}
+	m := NewWithReserved(special)
+	for i, s := range special {
+		if id := m.FindByString(s); id != int32(i) {
+			t.Errorf("expected %d; got %d for %q", i, id, s)
+		}
+	}
+	if id := m.Add("the"); id != 3 {
+		t.Errorf("expected 3; got %d", id)
+	}
+	if id := m.Add("<unk>"); id != 1 {
+		t.Errorf("expected 1; got %d", id)
+	}
+	if size := NewWithReserved(nil).Size(); size != 0 {
+		t.Errorf("expected size 0; got %d", size)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic on a duplicate reserved string")
+		}
+	}()
+	NewWithReserved([]string{"<pad>", "<pad>"})
+}
+
+func TestMapCopy(t *testing.T) {
+	m := FromSlice([]string{"a", "b"})
+	m.SetUnknown("<unk>")
+	c := m.Copy()
+	checkMapConsistency(c, t)
+	if !reflect.DeepEqual(c.intToStr, m.intToStr) {
+		t.Errorf("expected %q; got %q", m.intToStr, c.intToStr)
+	}
+	if id := c.Add("c"); id != 3 {
+		t.Errorf("expected 3; got %d", id)
+	}
+	if m.Size() != 3 || c.Size() != 4 {
+		t.Errorf("expected sizes 3 and 4; got %d and %d", m.Size(), c.Size())
+	}
+	if id := m.FindByString("c"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+	if id := c.FindByStringOrUnknown("d"); id != 2 {
+		t.Errorf("expected 2; got %d", id)
+	}
+	m.Freeze()
+	if !m.Copy().Frozen() {
+		t.Errorf("expected the copy of a frozen map to be frozen")
+	}
+}
+
+func TestMapEqual(t *testing.T) {
+	m := FromSlice([]string{"a", "b", "c"})
+	if !m.Equal(m.Copy()) {
+		t.Errorf("expected a map to equal its copy")
+	}
+	if !New().Equal(New()) {
+		t.Errorf("expected empty maps to be equal")
+	}
+	for _, other := range []*Map{
+		FromSlice([]string{"a", "b"}),
+		FromSlice([]string{"a", "b", "c", "d"}),
+		FromSlice([]string{"a", "c", "b"}),
+		New(),
+	} {
+		if m.Equal(other) || other.Equal(m) {
+			t.Errorf("expected %q and %q to differ", m.intToStr, other.intToStr)
+		}
+	}
+}
+
+func TestMapFreeze(t *testing.T) {
+	m := FromSlice([]string{"a", "b"})
+	if m.Frozen() {
+		t.Errorf("expected unfrozen map")
+	}
+	m.Freeze()
+	if !m.Frozen() {
+		t.Errorf("expected frozen map")
+	}
+	if id := m.Add("b"); id != 1 {
+		t.Errorf("expected 1; got %d", id)
+	}
+	if id := m.FindByString("c"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+	if s := m.FindByInt(0); s != "a" {
+		t.Errorf("expected %q; got %q", "a", s)
+	}
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("expected error; got nil")
+			}
+		}()
+		m.Add("c")
+	}()
+	if size := m.Size(); size != 2 {
+		t.Errorf("expected size 2; got %d", size)
+	}
+}
+
+func TestMapFind(t *testing.T) {
+	m := NewNormalized(strings.ToLower)
+	m.AddAll([]string{"a", "b"})
+	for _, c := range []struct {
+		s  string
+		id int32
+		ok bool
+	}{{"a", 0, true}, {"B", 1, true}, {"c", 0, false}} {
+		if id, ok := m.Find(c.s); id != c.id || ok != c.ok {
+			t.Errorf("expected (%d, %v); got (%d, %v) for %q", c.id, c.ok, id, ok, c.s)
+		}
+	}
+	for _, c := range []struct {
+		id int32
+		s  string
+		ok bool
+	}{{0, "a", true}, {1, "b", true}, {2, "", false}, {NoInt, "", false}} {
+		if s, ok := m.FindInt(c.id); s != c.s || ok != c.ok {
+			t.Errorf("expected (%q, %v); got (%q, %v) for %d", c.s, c.ok, s, ok, c.id)
+		}
+	}
+}
+
+func TestMapContains(t *testing.T) {
+	m := FromSlice([]string{"a", "b"})
+	for _, c := range []struct {
+		s        string
+		contains bool
+	}{{"a", true}, {"b", true}, {"c", false}, {"", false}} {
+		if contains := m.Contains(c.s); contains != c.contains {
+			t.Errorf("expected %v; got %v for %q", c.contains, contains, c.s)
+		}
+	}
+	for _, c := range []struct {
+		i        int32
+		contains bool
+	}{{0, true}, {1, true}, {2, false}, {NoInt, false}} {
+		if contains := m.ContainsInt(c.i); contains != c.contains {
+			t.Errorf("expected %v; got %v for %d", c.contains, contains, c.i)
+		}
+	}
+	if size := m.Size(); size != 2 {
+		t.Errorf("expected size 2; got %d", size)
+	}
+}
+
+func TestMapAddAll(t *testing.T) {
+	m := New()
+	m.AddAll([]string{"a", "b", "a", "c"})
+	m.AddAll(nil)
+	m.AddAll([]string{"c", "d"})
+	if expected := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(m.intToStr, expected) {
+		t.Errorf("expected %q; got %q", expected, m.intToStr)
+	}
+	checkMapConsistency(m, t)
+}
+
+func TestMapUnknown(t *testing.T) {
+	m := FromSlice([]string{"a", "b"})
+	if id := m.FindByStringOrUnknown("c"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+	m.SetUnknown("<unk>")
+	m.Freeze()
+	if id := m.FindByStringOrUnknown("c"); id != 2 {
+		t.Errorf("expected 2; got %d", id)
+	}
+	if id := m.FindByStringOrUnknown("b"); id != 1 {
+		t.Errorf("expected 1; got %d", id)
+	}
+	if id := m.FindByString("c"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+	if s := m.FindByInt(2); s != "<unk>" {
+		t.Errorf("expected %q; got %q", "<unk>", s)
+	}
+	// Setting an existing string reuses its id.
+	m.SetUnknown("a")
+	if id := m.FindByStringOrUnknown("c"); id != 0 {
+		t.Errorf("expected 0; got %d", id)
+	}
+}
+
+func TestNewNormalized(t *testing.T) {
+	m := NewNormalized(strings.ToLower)
+	if id := m.Add("The"); id != 0 {
+		t.Errorf("expected 0; got %d", id)
+	}
+	if id := m.Add("the"); id != 0 {
+		t.Errorf("expected 0; got %d", id)
+	}
+	if ids := m.TranslateByString([]string{"THE", "Cat"}); !reflect.DeepEqual(ids, []int32{0, 1}) {
+		t.Errorf("expected [0 1]; got %v", ids)
+	}
+	if size := m.Size(); size != 2 {
+		t.Errorf("expected size 2; got %d", size)
+	}
+	if id := m.FindByString("tHe"); id != 0 {
+		t.Errorf("expected 0; got %d", id)
+	}
+	if s := m.FindByInt(1); s != "cat" {
+		t.Errorf("expected %q; got %q", "cat", s)
+	}
+	m.SetUnknown("<UNK>")
+	if id := m.FindByStringOrUnknown("DOG"); id != 2 || m.FindByInt(2) != "<unk>" {
+		t.Errorf("expected 2 for %q; got %d for %q", "<unk>", id, m.FindByInt(id))
+	}
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("expected error; got nil")
+			}
+		}()
+		NewNormalized(strings.TrimSpace).Add("  ")
+	}()
+}
+
+func TestMapRange(t *testing.T) {
+	strs := []string{"a", "b", "c", "d"}
+	m := FromSlice(strs)
+	var visited []string
+	m.Range(func(id int32, s string) bool {
+		if id != int32(len(visited)) {
+			t.Errorf("expected %d; got %d", len(visited), id)
+		}
+		visited = append(visited, s)
+		return true
+	})
+	if !reflect.DeepEqual(visited, strs) {
+		t.Errorf("expected %v; got %v", strs, visited)
+	}
+	visited = nil
+	m.Range(func(id int32, s string) bool {
+		visited = append(visited, s)
+		return id < 1
+	})
+	if !reflect.DeepEqual(visited, strs[:2]) {
+		t.Errorf("expected %v; got %v", strs[:2], visited)
+	}
+	New().Range(func(int32, string) bool {
+		t.Errorf("unexpected call on empty map")
+		return true
+	})
+}
+
+func TestMapMerge(t *testing.T) {
+	a := FromSlice([]string{"a", "b", "c"})
+	b := FromSlice([]string{"d", "b", "e", "a"})
+	otherToA := a.Merge(b)
+	if expected := []int32{3, 1, 4, 0}; !reflect.DeepEqual(otherToA, expected) {
+		t.Errorf("expected %v; got %v", expected, otherToA)
+	}
+	if size := a.Size(); size != 5 {
+		t.Errorf("expected size 5; got %d", size)
+	}
+	for i, s := range []string{"a", "b", "c", "d", "e"} {
+		if id := a.FindByString(s); id != int32(i) {
+			t.Errorf("expected %d; got %d for %q", i, id, s)
+		}
+	}
+	for i, id := range otherToA {
+		if s, ss := b.FindByInt(int32(i)), a.FindByInt(id); s != ss {
+			t.Errorf("expected %q; got %q for id %d", s, ss, i)
+		}
+	}
+	if otherToA := a.Merge(New()); len(otherToA) != 0 {
+		t.Errorf("expected empty mapping; got %v", otherToA)
+	}
+}
+
+var readTextCases = []struct {
+	input string
+	strs  []string
+	err   error
+}{
+	{"", nil, nil},
+	{"a\n", []string{"a"}, nil},
+	{"a\nb c\n", []string{"a", "b c"}, nil},
+	{"a\nb", []string{"a", "b"}, nil},
+	{"a\n\nb\n", nil, BadFormat},
+	{"\n", nil, BadFormat},
+	{"a\nb\na\n", nil, BadFormat},
+}
+
+func TestReadText(t *testing.T) {
+	for _, c := range readTextCases {
+		m, err := ReadText(strings.NewReader(c.input))
+		if err != c.err {
+			t.Errorf("expected %v; got %v for %q", c.err, err, c.input)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var strs []string
+		m.Range(func(id int32, s string) bool {
+			strs = append(strs, s)
+			return true
+		})
+		if !reflect.DeepEqual(strs, c.strs) {
+			t.Errorf("expected %q; got %q for %q", c.strs, strs, c.input)
+		}
+	}
+}
+
+func TestMapWriteText(t *testing.T) {
+	m := FromSlice([]string{"the", "a cat", "\t"})
+	var buf bytes.Buffer
+	if err := m.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := "the\na cat\n\t\n"; buf.String() != expected {
+		t.Errorf("expected %q; got %q", expected, buf.String())
+	}
+	mm, err := ReadText(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !mm.Equal(m) {
+		t.Errorf("expected %q; got %q", m.intToStr, mm.intToStr)
+	}
+	checkMapConsistency(mm, t)
+
+	buf.Reset()
+	m.Add("two\nlines")
+	if err := m.WriteText(&buf); err != NewlineInString {
+		t.Errorf("expected %v; got %v", NewlineInString, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written; got %q", buf.String())
+	}
+}
+
+func TestMapDelete(t *testing.T) {
+	m := FromSlice([]string{"a", "b", "c", "d", "e"})
+	m.SetUnknown("d")
+	oldToNew := m.Delete([]string{"b", "x", "e", "b"})
+	if expected := []int32{0, NoInt, 1, 2, NoInt}; !reflect.DeepEqual(oldToNew, expected) {
+		t.Errorf("expected %v; got %v", expected, oldToNew)
+	}
+	checkMapConsistency(m, t)
+	if size := m.Size(); size != 3 {
+		t.Errorf("expected size 3; got %d", size)
+	}
+	for _, s := range []string{"b", "e"} {
+		if id := m.FindByString(s); id != NoInt {
+			t.Errorf("expected NoInt; got %d for %q", id, s)
+		}
+	}
+	if id := m.FindByStringOrUnknown("x"); id != 2 {
+		t.Errorf("expected 2; got %d", id)
+	}
+	m.Delete([]string{"d"})
+	checkMapConsistency(m, t)
+	if id := m.FindByStringOrUnknown("x"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+	if id := m.Add("f"); id != 2 {
+		t.Errorf("expected 2; got %d", id)
+	}
+}
+
+func TestMapDeleteFrozen(t *testing.T) {
+	m := FromSlice([]string{"a", "b"})
+	m.Freeze()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when deleting from a frozen map")
+		}
+		if expected := []string{"a", "b"}; !reflect.DeepEqual(m.intToStr, expected) {
+			t.Errorf("expected %q; got %q", expected, m.intToStr)
+		}
+	}()
+	m.Delete([]string{"a"})
+}
+
+// checkMapConsistency checks that strToInt and intToStr agree on
+// every entry.
+func checkMapConsistency(m *Map, t *testing.T) {
+	if len(m.strToInt) != len(m.intToStr) {
+		t.Errorf("strToInt has %d entries; intToStr has %d", len(m.strToInt), len(m.intToStr))
+	}
+	for i, s := range m.intToStr {
+		if id, ok := m.strToInt[s]; !ok || id != int32(i) {
+			t.Errorf("expected %d; got %d for %q", i, id, s)
+		}
+	}
+}
+
+func TestMapWriteToReadFrom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	m := New()
+	for m.Size() < 3000 {
+		b := make([]byte, 1+rng.Intn(20))
+		for i := range b {
+			b[i] = byte(rng.Intn(256))
+		}
+		m.Add(string(b))
+	}
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected %d bytes written; got %d", buf.Len(), n)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	mm, err := ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if mm.Size() != m.Size() {
+		t.Fatalf("expected size %d; got %d", m.Size(), mm.Size())
+	}
+	for i := int32(0); i < m.Size(); i++ {
+		s := m.FindByInt(i)
+		if ss := mm.FindByInt(i); ss != s {
+			t.Errorf("expected %q; got %q", s, ss)
+		}
+		if id := mm.FindByString(s); id != i {
+			t.Errorf("expected %d; got %d", i, id)
+		}
+	}
+
+	// Empty map
+	buf.Reset()
+	New().WriteTo(&buf)
+	if mm, err := ReadFrom(&buf); err != nil || mm.Size() != 0 {
+		t.Errorf("expected empty map; got %v and %v", mm, err)
+	}
+
+	// Truncated and malformed input
+	if _, err := ReadFrom(bytes.NewReader(data[:len(data)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v; got %v", io.ErrUnexpectedEOF, err)
+	}
+	if _, err := ReadFrom(bytes.NewReader([]byte{2, 1, 'a', 1, 'a'})); err != BadFormat {
+		t.Errorf("expected %v; got %v", BadFormat, err)
+	}
+	if _, err := ReadFrom(bytes.NewReader([]byte{1, 0})); err != BadFormat {
+		t.Errorf("expected %v; got %v", BadFormat, err)
+	}
+	// A huge length with a short payload
+	if _, err := ReadFrom(bytes.NewReader([]byte{1, 0xff, 0xff, 0xff, 0xff, 0x07, 'a'})); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v; got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	// Failing writer
+	for _, limit := range []int{0, 1, 100, len(data) - 1} {
+		w := &limitedWriter{limit: limit}
+		n, err := m.WriteTo(w)
+		if err != io.ErrShortWrite {
+			t.Errorf("expected %v; got %v", io.ErrShortWrite, err)
+		}
+		if n != int64(w.buf.Len()) {
+			t.Errorf("expected %d bytes written; got %d", w.buf.Len(), n)
+		}
+	}
+}
+
+// limitedWriter accepts up to limit bytes and then fails.
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); len(p) > room {
+		w.buf.Write(p[:room])
+		return room, io.ErrShortWrite
+	}
+	return w.buf.Write(p)
+}
+
+func TestNewWithCapacity(t *testing.T) {
+	m := NewWithCapacity(10)
+	if size := m.Size(); size != 0 {
+		t.Errorf("expected empty map; got size %d", size)
+	}
+	for i, s := range []string{"a", "b", "a"} {
+		if id := m.Add(s); id != int32(i%2) {
+			t.Errorf("expected %d; got %d", i%2, id)
+		}
+	}
+	if id := m.FindByStringOrUnknown("c"); id != NoInt {
+		t.Errorf("expected NoInt; got %d", id)
+	}
+}
+
+var benchmarkStrings = func() []string {
+	strs := make([]string, 100000)
+	for i := range strs {
+		strs[i] = strconv.Itoa(i)
+	}
+	return strs
+}()
+
+func BenchmarkAdd(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := New()
+		for _, s := range benchmarkStrings {
+			m.Add(s)
+		}
+	}
+}
+
+func BenchmarkAddWithCapacity(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := NewWithCapacity(len(benchmarkStrings))
+		for _, s := range benchmarkStrings {
+			m.Add(s)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package bimap
+
+import (
+	"sort"
+)
+
+// CountingMap is a Map that also counts how many times each string is
+// added, e.g. for building a vocabulary with frequencies.
+type CountingMap struct {
+	m      *Map
+	counts []int
+	total  int
+}
+
+// NewCountingMap creates an empty CountingMap.
+func NewCountingMap() *CountingMap {
+	return &CountingMap{m: New()}
+}
+
+// Add adds one occurrence of the given string and returns its
+// id. This is not thread safe.
+func (c *CountingMap) Add(s string) int32 {
+	i := c.m.Add(s)
+	// Strings added to the underlying Map directly have no count yet.
+	for int(i) >= len(c.counts) {
+		c.counts = append(c.counts, 0)
+	}
+	c.counts[i]++
+	c.total++
+	return i
+}
+
+// Map returns the underlying Map for lookups. Strings added through it
+// directly are not counted.
+func (c *CountingMap) Map() *Map {
+	return c.m
+}
+
+// Count returns the number of times the string with the given id has
+// been added, or 0 if the id is not in the map.
+func (c *CountingMap) Count(i int32) int {
+	if 0 <= i && int(i) < len(c.counts) {
+		return c.counts[i]
+	}
+	return 0
+}
+
+// Counts returns a copy of the counts in id order.
+func (c *CountingMap) Counts() []int {
+	counts := make([]int, c.m.Size())
+	copy(counts, c.counts)
+	return counts
+}
+
+// TotalCount returns the total number of strings added.
+func (c *CountingMap) TotalCount() int {
+	return c.total
+}
+
+// SortedByCount returns the strings in descending order of their
+// counts, with ties broken by increasing id. The ids are not changed.
+func (c *CountingMap) SortedByCount() []string {
+	ids := make([]int32, c.m.Size())
+	for i := range ids {
+		ids[i] = int32(i)
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return c.Count(ids[i]) > c.Count(ids[j]) })
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = c.m.FindByInt(id)
+	}
+	return strs
+}
+
+// Prune removes the strings added less than minCount times and
+// assigns the remaining ones new dense ids, keeping their relative
+// order. It returns the mapping from old ids to new ids, where removed
+// strings are mapped to NoInt, as from Topology.Topsort. Like
+// Map.Delete, it panics when the underlying Map is frozen.
+func (c *CountingMap) Prune(minCount int) []int32 {
+	keep := make([]bool, c.m.Size())
+	for i := range keep {
+		keep[i] = c.Count(int32(i)) >= minCount
+	}
+	oldToNew := c.m.compact(keep)
+	counts := make([]int, 0, c.m.Size())
+	c.total = 0
+	for i, n := range oldToNew {
+		if n != NoInt {
+			counts = append(counts, c.Count(int32(i)))
+			c.total += c.Count(int32(i))
+		}
+	}
+	c.counts = counts
+	return oldToNew
+}
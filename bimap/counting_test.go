@@ -0,0 +1,106 @@
+package bimap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountingMap(t *testing.T) {
+	c := NewCountingMap()
+	for _, s := range []string{"a", "b", "a", "c", "a", "b"} {
+		c.Add(s)
+	}
+	if size := c.Map().Size(); size != 3 {
+		t.Errorf("expected size 3; got %d", size)
+	}
+	expected := []int{3, 2, 1}
+	for i, n := range expected {
+		if count := c.Count(int32(i)); count != n {
+			t.Errorf("expected %d; got %d for %q", n, count, c.Map().FindByInt(int32(i)))
+		}
+	}
+	if counts := c.Counts(); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+	if total := c.TotalCount(); total != 6 {
+		t.Errorf("expected 6; got %d", total)
+	}
+	if count := c.Count(NoInt); count != 0 {
+		t.Errorf("expected 0; got %d", count)
+	}
+	if count := c.Count(3); count != 0 {
+		t.Errorf("expected 0; got %d", count)
+	}
+}
+
+func TestCountingMapPrune(t *testing.T) {
+	c := NewCountingMap()
+	for _, s := range []string{"a", "b", "a", "c", "d", "a", "d", "e"} {
+		c.Add(s)
+	}
+	c.Map().Add("f")
+	if expected := []int{3, 1, 1, 2, 1, 0}; !reflect.DeepEqual(c.Counts(), expected) {
+		t.Errorf("expected %v; got %v", expected, c.Counts())
+	}
+	oldToNew := c.Prune(2)
+	if expected := []int32{0, NoInt, NoInt, 1, NoInt, NoInt}; !reflect.DeepEqual(oldToNew, expected) {
+		t.Errorf("expected %v; got %v", expected, oldToNew)
+	}
+	m := c.Map()
+	if size := m.Size(); size != 2 {
+		t.Errorf("expected size 2; got %d", size)
+	}
+	for i, s := range []string{"a", "d"} {
+		if id := m.FindByString(s); id != int32(i) {
+			t.Errorf("expected %d; got %d for %q", i, id, s)
+		}
+		if ss := m.FindByInt(int32(i)); ss != s {
+			t.Errorf("expected %q; got %q", s, ss)
+		}
+	}
+	for _, s := range []string{"b", "c", "e", "f"} {
+		if id := m.FindByString(s); id != NoInt {
+			t.Errorf("expected NoInt; got %d for %q", id, s)
+		}
+	}
+	if expected := []int{3, 2}; !reflect.DeepEqual(c.Counts(), expected) {
+		t.Errorf("expected %v; got %v", expected, c.Counts())
+	}
+	if total := c.TotalCount(); total != 5 {
+		t.Errorf("expected 5; got %d", total)
+	}
+	// New strings continue the dense range.
+	if id := c.Add("b"); id != 2 || c.Count(2) != 1 {
+		t.Errorf("expected id 2 with count 1; got %d with count %d", id, c.Count(id))
+	}
+
+	c.Map().Freeze()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when pruning a frozen map")
+		}
+		if size := c.Map().Size(); size != 3 {
+			t.Errorf("expected size 3; got %d", size)
+		}
+	}()
+	c.Prune(2)
+}
+
+func TestCountingMapSortedByCount(t *testing.T) {
+	c := NewCountingMap()
+	if strs := c.SortedByCount(); len(strs) != 0 {
+		t.Errorf("expected nothing; got %q", strs)
+	}
+	for _, s := range strings.Fields("the cat saw the dog and the dog saw a cat") {
+		c.Add(s)
+	}
+	c.Map().Add("unseen")
+	expected := []string{"the", "cat", "saw", "dog", "and", "a", "unseen"}
+	if strs := c.SortedByCount(); !reflect.DeepEqual(strs, expected) {
+		t.Errorf("expected %q; got %q", expected, strs)
+	}
+	if id := c.Map().FindByString("the"); id != 0 {
+		t.Errorf("expected 0; got %d", id)
+	}
+}
@@ -0,0 +1,56 @@
+package bimap
+
+import (
+	"sync"
+)
+
+// SyncMap wraps a Map for concurrent use. Its methods have the same
+// semantics as those of Map.
+type SyncMap struct {
+	mu sync.RWMutex
+	m  *Map
+}
+
+// NewSyncMap creates an empty SyncMap.
+func NewSyncMap() *SyncMap {
+	return &SyncMap{m: New()}
+}
+
+// Add adds the given string into the map and returns its id. Strings
+// already in the map are found under the read lock; the write lock is
+// only taken on a miss.
+func (s *SyncMap) Add(str string) int32 {
+	s.mu.RLock()
+	i := s.m.FindByString(str)
+	s.mu.RUnlock()
+	if i != NoInt {
+		return i
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another goroutine may have added str in between.
+	return s.m.Add(str)
+}
+
+// FindByString finds the id or returns NoInt if the string is not in
+// the map.
+func (s *SyncMap) FindByString(str string) int32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.FindByString(str)
+}
+
+// FindByInt finds the string corresponding to the given integral
+// id, or an empty string if the id is not in the map.
+func (s *SyncMap) FindByInt(i int32) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.FindByInt(i)
+}
+
+// Size returns the size of the map.
+func (s *SyncMap) Size() int32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m.Size()
+}
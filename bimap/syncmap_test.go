@@ -0,0 +1,54 @@
+package bimap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSyncMap(t *testing.T) {
+	const numGoroutines, numStrings = 200, 100
+	m := NewSyncMap()
+	ids := make([][]int32, numGoroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			// Each goroutine adds an overlapping window of strings.
+			for i := 0; i < numStrings; i++ {
+				ids[g] = append(ids[g], m.Add(strconv.Itoa(g+i)))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	size := m.Size()
+	if expected := int32(numGoroutines + numStrings - 1); size != expected {
+		t.Fatalf("expected size %d; got %d", expected, size)
+	}
+	seen := make([]bool, size)
+	for i := int32(0); i < size; i++ {
+		s := m.FindByInt(i)
+		if s == "" {
+			t.Fatalf("missing id %d", i)
+		}
+		if id := m.FindByString(s); id != i {
+			t.Errorf("expected %d; got %d for %q", i, id, s)
+		}
+		n, _ := strconv.Atoi(s)
+		seen[n] = true
+	}
+	for n, ok := range seen {
+		if !ok {
+			t.Errorf("missing string %d", n)
+		}
+	}
+	for g := range ids {
+		for i, id := range ids[g] {
+			if s := m.FindByInt(id); s != strconv.Itoa(g+i) {
+				t.Errorf("expected %q; got %q for id %d", strconv.Itoa(g+i), s, id)
+			}
+		}
+	}
+}
@@ -65,6 +65,15 @@ type TableHeadFinder struct {
 }
 
 func (finder *TableHeadFinder) FindHead(parent string, children []string) int {
+	i, _ := finder.FindHeadExplain(parent, children)
+	return i
+}
+
+// FindHeadExplain is like FindHead but also tells whether the head is
+// decided by the priority table, i.e. whether the parent has a rule
+// and at least one child has a label in its priority table. When
+// matched is false, the head is merely the default of the direction.
+func (finder *TableHeadFinder) FindHeadExplain(parent string, children []string) (index int, matched bool) {
 	if len(children) == 0 {
 		panic("trying to find the head of a leaf: " + parent)
 	}
@@ -72,13 +81,14 @@ func (finder *TableHeadFinder) FindHead(parent string, children []string) int {
 	if !ok {
 		switch finder.Fallback {
 		case HEAD_INITIAL:
-			return 0
+			return 0, false
 		case HEAD_FINAL:
-			return len(children) - 1
+			return len(children) - 1, false
 		default:
 			panic("unknown category: " + parent)
 		}
 	}
+	lowest := len(rule.Priority)
 	switch rule.Direction {
 	case HEAD_INITIAL:
 		i := 0
@@ -89,7 +99,7 @@ func (finder *TableHeadFinder) FindHead(parent string, children []string) int {
 				p = pp
 			}
 		}
-		return i
+		return i, p < lowest
 	case HEAD_FINAL:
 		i := len(children) - 1
 		p := rule.LabelPriority(children[i])
@@ -99,7 +109,7 @@ func (finder *TableHeadFinder) FindHead(parent string, children []string) int {
 				p = pp
 			}
 		}
-		return i
+		return i, p < lowest
 	default:
 		panic(fmt.Sprintf("invalid rule.Direction: %d", rule.Direction))
 	}
@@ -91,6 +91,39 @@ func TestTableHeadFinder(t *testing.T) {
 	}()
 }
 
+func TestTableHeadFinderExplain(t *testing.T) {
+	finder := &TableHeadFinder{
+		map[string]*HeadRule{
+			"a": NewHeadRule(HEAD_INITIAL, []string{"a", "b"}),
+			"b": NewHeadRule(HEAD_FINAL, []string{"a", "b"}),
+			"c": NewHeadRule(HEAD_FINAL, nil),
+		},
+		HEAD_FINAL,
+	}
+	inputs := []struct {
+		parent   string
+		children []string
+		head     int
+		matched  bool
+	}{
+		{"a", []string{"c", "b", "a"}, 2, true},
+		{"a", []string{"c", "d", "e"}, 0, false},
+		{"b", []string{"b", "c", "a"}, 2, true},
+		{"b", []string{"c", "d", "e"}, 2, false},
+		{"c", []string{"a", "b"}, 1, false},
+		{"d", []string{"a", "b"}, 1, false},
+	}
+	for _, input := range inputs {
+		head, matched := finder.FindHeadExplain(input.parent, input.children)
+		if head != input.head || matched != input.matched {
+			t.Errorf("expected (%d, %v); got (%d, %v) as head of %q -> %q\n", input.head, input.matched, head, matched, input.parent, input.children)
+		}
+		if head := finder.FindHead(input.parent, input.children); head != input.head {
+			t.Errorf("expected %d; got %d as head of %q -> %q\n", input.head, head, input.parent, input.children)
+		}
+	}
+}
+
 func TestEnglishHeadFinderNP(t *testing.T) {
 	finder := NewEnglishHeadFinder()
 	inputs := []struct {
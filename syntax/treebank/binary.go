@@ -0,0 +1,60 @@
+package treebank
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// treeGob is the gob representation of a ParseTree.
+type treeGob struct {
+	Root     NodeId
+	Children [][]NodeId
+	Label    []string
+	Id       []int32
+	Span     []Span
+	Head     []int
+	HeadLeaf []NodeId
+	Yield    []NodeId
+	POS      []NodeId
+	Role     []string
+	StableId []int
+}
+
+// MarshalBinary encodes the topology and all the annotations of the
+// tree using encoding/gob. Map and the UpLink of the Topology are not
+// encoded; the caller has to keep the label mapping separately (see
+// bimap.Map.WriteTo()). Empty slices, including the children slices
+// of leaves, are decoded as nil.
+func (tree *ParseTree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(treeGob{
+		tree.Topology.Root, tree.Topology.Children,
+		tree.Label, tree.Id, tree.Span, tree.Head, tree.HeadLeaf,
+		tree.Yield, tree.POS, tree.Role, tree.StableId})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into the
+// tree, replacing its Topology and annotations. Map is set to nil.
+func (tree *ParseTree) UnmarshalBinary(data []byte) error {
+	var g treeGob
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); err != nil {
+		return err
+	}
+	*tree = ParseTree{
+		Topology: &Topology{Root: g.Root, Children: g.Children},
+		Label:    g.Label,
+		Id:       g.Id,
+		Span:     g.Span,
+		Head:     g.Head,
+		HeadLeaf: g.HeadLeaf,
+		Yield:    g.Yield,
+		POS:      g.POS,
+		Role:     g.Role,
+		StableId: g.StableId,
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package treebank
+
+import (
+	"github.com/kho/nlp_basic/bimap"
+	"github.com/kho/nlp_basic/syntax/heads"
+	"reflect"
+	"testing"
+)
+
+func TestParseTreeMarshalBinary(t *testing.T) {
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
+	for _, input := range []string{"(())", "((S (NP (DT the) (NN cat)) (VP (VBD sat))))"} {
+		tree := FromString(input)
+		tree.Fill(FILL_EVERYTHING, bimap.New(), finder)
+		tree.AnnotateSpans(map[Span]string{{0, 2}: "ARG0"})
+		tree.AssignStableIds()
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Errorf("unexpected error %v for %q", err, input)
+			continue
+		}
+		var decoded ParseTree
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Errorf("unexpected error %v for %q", err, input)
+			continue
+		}
+		if !decoded.Equal(tree) {
+			t.Errorf("expected %q; got %q", tree, &decoded)
+		}
+		fields := []struct {
+			name      string
+			got, want interface{}
+		}{
+			{"Id", decoded.Id, tree.Id},
+			{"Span", decoded.Span, tree.Span},
+			{"Head", decoded.Head, tree.Head},
+			{"HeadLeaf", decoded.HeadLeaf, tree.HeadLeaf},
+			{"Yield", decoded.Yield, tree.Yield},
+			{"POS", decoded.POS, tree.POS},
+			{"Role", decoded.Role, tree.Role},
+			{"StableId", decoded.StableId, tree.StableId},
+		}
+		for _, f := range fields {
+			if !reflect.DeepEqual(f.got, f.want) {
+				t.Errorf("expected %s %v; got %v for %q", f.name, f.want, f.got, input)
+			}
+		}
+	}
+	var tree ParseTree
+	if err := tree.UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Errorf("expected an error; got nil")
+	}
+}
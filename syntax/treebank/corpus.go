@@ -0,0 +1,251 @@
+package treebank
+
+import (
+	"github.com/kho/nlp_basic/syntax/heads"
+	"io"
+	"strings"
+)
+
+// DedupTrees returns the trees with later duplicates (i.e. Equal to
+// an earlier tree) removed. Trees are first bucketed by Hash so that
+// Equal is only tested within a bucket. The input slice is not
+// modified.
+func DedupTrees(trees []*ParseTree) []*ParseTree {
+	buckets := make(map[uint64][]*ParseTree)
+	deduped := make([]*ParseTree, 0, len(trees))
+	for _, tree := range trees {
+		h := tree.Hash()
+		dup := false
+		for _, other := range buckets[h] {
+			if tree.Equal(other) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			buckets[h] = append(buckets[h], tree)
+			deduped = append(deduped, tree)
+		}
+	}
+	return deduped
+}
+
+// Complexity holds structural complexity measures of a tree.
+type Complexity struct {
+	// Depth is the number of edges on the longest path from Root to a
+	// leaf.
+	Depth int
+	// NumNodes is the number of nodes under Root.
+	NumNodes int
+	// MaxBranch is the largest number of children of a single node.
+	MaxBranch int
+	// MeanDepLength is the mean distance in words between the two ends
+	// of the dependency arcs derived from HeadLeaf; it is 0 when
+	// HeadLeaf is not available.
+	MeanDepLength float64
+}
+
+// ParseComplexity computes the Complexity of the tree in a single
+// traversal, plus a pass over the dependency arcs when a valid
+// HeadLeaf slice is present.
+func ParseComplexity(tree *ParseTree) Complexity {
+	var c Complexity
+	if tree.Topology.Root == NoNodeId {
+		return c
+	}
+	pos := make([]int, tree.Topology.NumNodes())
+	numLeaves := 0
+	dfsComplexity(tree.Topology, tree.Topology.Root, 0, pos, &numLeaves, &c)
+	if len(tree.HeadLeaf) == tree.Topology.NumNodes() {
+		arcs := tree.headArcs()
+		total := 0
+		for _, a := range arcs {
+			d := pos[a.head] - pos[a.dep]
+			if d < 0 {
+				d = -d
+			}
+			total += d
+		}
+		if len(arcs) > 0 {
+			c.MeanDepLength = float64(total) / float64(len(arcs))
+		}
+	}
+	return c
+}
+
+func dfsComplexity(t *Topology, n NodeId, depth int, pos []int, numLeaves *int, c *Complexity) {
+	c.NumNodes++
+	if depth > c.Depth {
+		c.Depth = depth
+	}
+	if t.Leaf(n) {
+		pos[n] = *numLeaves
+		*numLeaves++
+		return
+	}
+	if len(t.Children[n]) > c.MaxBranch {
+		c.MaxBranch = len(t.Children[n])
+	}
+	for _, child := range t.Children[n] {
+		dfsComplexity(t, child, depth+1, pos, numLeaves, c)
+	}
+}
+
+// Branching holds the statistics of the number of children of the
+// internal nodes in a corpus.
+type Branching struct {
+	MaxFanout       int
+	MeanFanout      float64
+	FanoutHistogram map[int]int // Number of children -> number of nodes
+}
+
+// BranchingStats computes the Branching statistics over the internal
+// nodes (pre-terminals included) under the Root of every tree. Nil
+// trees are skipped.
+func BranchingStats(trees []*ParseTree) Branching {
+	b := Branching{FanoutHistogram: make(map[int]int)}
+	numNodes, numChildren := 0, 0
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		for _, node := range tree.Topology.preOrder() {
+			fanout := len(tree.Topology.Children[node])
+			if fanout == 0 {
+				continue
+			}
+			b.FanoutHistogram[fanout]++
+			if fanout > b.MaxFanout {
+				b.MaxFanout = fanout
+			}
+			numNodes++
+			numChildren += fanout
+		}
+	}
+	if numNodes > 0 {
+		b.MeanFanout = float64(numChildren) / float64(numNodes)
+	}
+	return b
+}
+
+// BuildLexicon counts, for each POS tag, how many times each word
+// appears under it in the trees. Nil trees are skipped.
+func BuildLexicon(trees []*ParseTree) map[string]map[string]int {
+	lexicon := make(map[string]map[string]int)
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		for _, token := range tree.TaggedTokens() {
+			words := lexicon[token.Tag]
+			if words == nil {
+				words = make(map[string]int)
+				lexicon[token.Tag] = words
+			}
+			words[token.Word]++
+		}
+	}
+	return lexicon
+}
+
+// productionString formats a CFG rule as "parent -> child1 child2 ...".
+func productionString(parent string, children []string) string {
+	return parent + " -> " + strings.Join(children, " ")
+}
+
+// HeadDisagreementByRule runs both head finders on every internal
+// node of the trees and counts the nodes where they disagree, keyed
+// by the rule at the node as "parent -> child1 child2 ...". Label
+// must be valid in every tree. Nil trees are skipped.
+func HeadDisagreementByRule(trees []*ParseTree, a, b heads.HeadFinder) map[string]int {
+	counts := make(map[string]int)
+	children := make([]string, 0, 16)
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		if len(tree.Label) != tree.Topology.NumNodes() {
+			panic("Label and Topology do not match in size")
+		}
+		for _, node := range tree.Topology.preOrder() {
+			if tree.Topology.Leaf(node) {
+				continue
+			}
+			children = children[:0]
+			for _, child := range tree.Topology.Children[node] {
+				children = append(children, tree.Label[child])
+			}
+			parent := tree.Label[node]
+			if a.FindHead(parent, children) != b.FindHead(parent, children) {
+				counts[productionString(parent, children)]++
+			}
+		}
+	}
+	return counts
+}
+
+// CorpusError is a parse error of the tree at Index (0-based) in the
+// input.
+type CorpusError struct {
+	Index int
+	Err   error
+}
+
+// CorpusReport summarizes the trees in an input.
+type CorpusReport struct {
+	// NumTrees is the number of trees, including empty and broken
+	// ones.
+	NumTrees int
+	// NumEmpty is the number of empty trees (i.e. "(())").
+	NumEmpty int
+	Errors   []CorpusError
+}
+
+// ValidateCorpus parses all the trees from input, recording the parse
+// errors instead of stopping at the first one (see Parser.Recover).
+// An IO error other than io.EOF is recorded as an error of the tree
+// being read and ends the validation.
+func ValidateCorpus(input io.ByteScanner) CorpusReport {
+	var r CorpusReport
+	p := NewParser(input)
+	for {
+		tree, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		r.NumTrees++
+		if err != nil {
+			r.Errors = append(r.Errors, CorpusError{r.NumTrees - 1, err})
+			if !isParseError(err) || p.Recover() != nil {
+				break
+			}
+			continue
+		}
+		if tree.Topology.Root == NoNodeId {
+			r.NumEmpty++
+		}
+	}
+	return r
+}
+
+// HeadTransitionCounts runs finder on every internal node of the
+// trees other than pre-terminals and counts, per parent label, the
+// labels of the head children. Label must be valid in every tree.
+// Nil trees are skipped.
+func HeadTransitionCounts(trees []*ParseTree, finder heads.HeadFinder) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		tree.ForEachProduction(false, func(parent string, children []string) {
+			byHead := counts[parent]
+			if byHead == nil {
+				byHead = make(map[string]int)
+				counts[parent] = byHead
+			}
+			byHead[children[finder.FindHead(parent, children)]]++
+		})
+	}
+	return counts
+}
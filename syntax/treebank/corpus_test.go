@@ -0,0 +1,148 @@
+package treebank
+
+import (
+	"github.com/kho/nlp_basic/syntax/heads"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedupTrees(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP a) (VP b)))"),
+		FromString("((S (NP a) (VP c)))"),
+		FromString("((S (NP a) (VP b)))"),
+	}
+	deduped := DedupTrees(trees)
+	if len(deduped) != 2 {
+		t.Fatalf("expected 2 trees; got %d", len(deduped))
+	}
+	if deduped[0] != trees[0] || deduped[1] != trees[1] {
+		t.Errorf("expected the first occurrences to survive; got %v", deduped)
+	}
+}
+
+func TestParseComplexity(t *testing.T) {
+	if c := ParseComplexity(FromString("(())")); c != (Complexity{}) {
+		t.Errorf("expected zero complexity; got %+v", c)
+	}
+
+	tree := FromString("((S (NP (DT the) (JJ big) (NN cat)) (VP (V sat))))")
+	expected := Complexity{Depth: 3, NumNodes: 11, MaxBranch: 3}
+	if c := ParseComplexity(tree); c != expected {
+		t.Errorf("expected %+v; got %+v", expected, c)
+	}
+
+	tree.FillHead(&heads.TableHeadFinder{Fallback: heads.HEAD_FINAL})
+	tree.FillHeadLeaf()
+	// Arcs: sat -> cat, cat -> the, cat -> big
+	expected.MeanDepLength = 4.0 / 3
+	if c := ParseComplexity(tree); c != expected {
+		t.Errorf("expected %+v; got %+v", expected, c)
+	}
+}
+
+func TestBranchingStats(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP a) (VP b) (. c)))"),
+		nil,
+		FromString("((S (NP (DT a) (NN b)) (VP c)))"),
+		FromString("(())"),
+	}
+	b := BranchingStats(trees)
+	if b.MaxFanout != 3 {
+		t.Errorf("expected max fan-out 3; got %d", b.MaxFanout)
+	}
+	if b.MeanFanout != 13.0/9 {
+		t.Errorf("expected mean fan-out %v; got %v", 13.0/9, b.MeanFanout)
+	}
+	if expected := map[int]int{1: 6, 2: 2, 3: 1}; !reflect.DeepEqual(b.FanoutHistogram, expected) {
+		t.Errorf("expected %v; got %v", expected, b.FanoutHistogram)
+	}
+}
+
+func TestBuildLexicon(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP (DT the) (NN dog)))))"),
+		FromString("((S (NP (DT the) (NN dog)) (VP (VBD ran))))"),
+	}
+	lexicon := BuildLexicon(trees)
+	if n := lexicon["DT"]["the"]; n != 3 {
+		t.Errorf("expected 3; got %d for (DT the)", n)
+	}
+	if n := lexicon["NN"]["dog"]; n != 2 {
+		t.Errorf("expected 2; got %d for (NN dog)", n)
+	}
+	if n := lexicon["VBD"]["the"]; n != 0 {
+		t.Errorf("expected 0; got %d for (VBD the)", n)
+	}
+	if n := len(lexicon); n != 3 {
+		t.Errorf("expected 3 tags; got %d", n)
+	}
+}
+
+func TestHeadDisagreementByRule(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))"),
+		FromString("((S (NP (DT a) (NN dog)) (VP (VBD saw) (NP it))))"),
+	}
+	a := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"S":  heads.NewHeadRule(heads.HEAD_FINAL, []string{"VP"}),
+			"VP": heads.NewHeadRule(heads.HEAD_FINAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_INITIAL,
+	}
+	b := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
+	counts := HeadDisagreementByRule(trees, a, b)
+	expected := map[string]int{"NP -> DT NN": 2, "VP -> VBD NP": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+}
+
+func TestHeadTransitionCounts(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))"),
+		FromString("((S (NP (DT a) (NN dog)) (VP (VBD saw) (NP it)) (. .)))"),
+		nil,
+	}
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"S":  heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VP"}),
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	counts := HeadTransitionCounts(trees, finder)
+	expected := map[string]map[string]int{
+		"S":  {"VP": 2},
+		"NP": {"NN": 2},
+		"VP": {"VBD": 2},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+}
+
+var validateCorpusCases = []struct {
+	input    string
+	numTrees int
+	numEmpty int
+	errors   []CorpusError
+}{
+	{"", 0, 0, nil},
+	{"((A a))\n(())\n((B (C c) d))\n((D d))\n", 4, 1, []CorpusError{{2, NoCloseParen}}},
+	{"((A a)) (B b) ((C c))", 3, 0, []CorpusError{{1, NoOpenParen}}},
+	{"((A a))\n((B b", 2, 0, []CorpusError{{1, NoCloseParen}}},
+}
+
+func TestValidateCorpus(t *testing.T) {
+	for _, c := range validateCorpusCases {
+		r := ValidateCorpus(strings.NewReader(c.input))
+		expected := CorpusReport{c.numTrees, c.numEmpty, c.errors}
+		if !reflect.DeepEqual(r, expected) {
+			t.Errorf("expected %+v; got %+v for %q", expected, r, c.input)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package treebank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors returned when converting dependencies to constituents.
+var (
+	BadHeads      = errors.New("heads do not form a tree over the words")
+	NonProjective = errors.New("dependencies are not projective")
+)
+
+// arc is a head-to-dependent relation between two leaves that is
+// established at the constituent parent.
+type arc struct {
+	head, dep, parent NodeId
+}
+
+// headArcs lists the arcs implied by HeadLeaf in pre-order of their
+// parents: for each non-head child of a node in the tree, an arc goes
+// from the node's head leaf to the child's head leaf. A valid
+// HeadLeaf slice must present.
+func (tree *ParseTree) headArcs() []arc {
+	var arcs []arc
+	for _, node := range tree.Topology.preOrder() {
+		for _, child := range tree.Topology.Children[node] {
+			if head, dep := tree.HeadLeaf[node], tree.HeadLeaf[child]; head != dep {
+				arcs = append(arcs, arc{head, dep, node})
+			}
+		}
+	}
+	return arcs
+}
+
+// Dependency is an arc from the head leaf to a dependent leaf.
+type Dependency struct {
+	Head, Dependent NodeId
+}
+
+// Dependencies returns the dependencies implied by HeadLeaf in
+// pre-order of the constituents they are established at: for each
+// non-head child of a node, the head leaf of the node governs the
+// head leaf of the child. The dependencies are projective with respect
+// to the yield. HeadLeaf must be valid.
+func (tree *ParseTree) Dependencies() []Dependency {
+	if len(tree.HeadLeaf) != tree.Topology.NumNodes() {
+		panic("HeadLeaf and Topology do not match in size")
+	}
+	arcs := tree.headArcs()
+	deps := make([]Dependency, len(arcs))
+	for i, a := range arcs {
+		deps[i] = Dependency{a.head, a.dep}
+	}
+	return deps
+}
+
+// NonProjectiveArcs returns the number of pairs of crossing
+// dependency arcs, where the arcs are derived from HeadLeaf and the
+// word order is given by the Span of the leaves. Valid HeadLeaf and
+// Span slices must present; otherwise NoHeadLeaf or NoSpan is
+// returned.
+func (tree *ParseTree) NonProjectiveArcs() (int, error) {
+	numNodes := tree.Topology.NumNodes()
+	if len(tree.HeadLeaf) != numNodes {
+		return 0, NoHeadLeaf
+	}
+	if len(tree.Span) != numNodes {
+		return 0, NoSpan
+	}
+	arcs := tree.headArcs()
+	left := make([]int, len(arcs))
+	right := make([]int, len(arcs))
+	for i, a := range arcs {
+		left[i], right[i] = tree.Span[a.head].Left, tree.Span[a.dep].Left
+		if left[i] > right[i] {
+			left[i], right[i] = right[i], left[i]
+		}
+	}
+	crossings := 0
+	for i := range arcs {
+		for j := i + 1; j < len(arcs); j++ {
+			if left[i] < left[j] && left[j] < right[i] && right[i] < right[j] ||
+				left[j] < left[i] && left[i] < right[j] && right[j] < right[i] {
+				crossings++
+			}
+		}
+	}
+	return crossings, nil
+}
+
+// ShiftReduceActions returns the gold action sequence of the
+// arc-standard transition system for the dependencies derived from
+// HeadLeaf. The system has a stack and a buffer of words, starting
+// with an empty stack and all the words in the buffer, and three
+// actions:
+//
+//	SHIFT           moves the first word of the buffer onto the stack;
+//	REDUCE-L-label  makes the top word of the stack the head of the
+//	                second top one, which is popped;
+//	REDUCE-R-label  makes the second top word the head of the top one,
+//	                which is popped.
+//
+// label is the label of the constituent where the dependent attaches
+// to its head. The oracle reduces as early as possible, but only
+// reduces a dependent to the right once it has collected all its own
+// dependents. Valid Label and HeadLeaf slices must present.
+func (tree *ParseTree) ShiftReduceActions() []string {
+	numNodes := tree.Topology.NumNodes()
+	if len(tree.HeadLeaf) != numNodes {
+		panic("HeadLeaf and Topology do not match in size")
+	}
+	if len(tree.Label) != numNodes {
+		panic("Label and Topology do not match in size")
+	}
+	index, yield := tree.LeafIndexMap()
+	head := make([]int, len(yield))
+	label := make([]string, len(yield))
+	numDeps := make([]int, len(yield))
+	for i := range head {
+		head[i] = -1
+	}
+	for _, a := range tree.headArcs() {
+		dep := index[a.dep]
+		head[dep] = index[a.head]
+		label[dep] = tree.Label[a.parent]
+		numDeps[head[dep]]++
+	}
+
+	var actions []string
+	stack := make([]int, 0, len(yield))
+	next := 0
+	for next < len(yield) || len(stack) > 1 {
+		if n := len(stack); n >= 2 {
+			s0, s1 := stack[n-1], stack[n-2]
+			if head[s1] == s0 {
+				actions = append(actions, "REDUCE-L-"+label[s1])
+				numDeps[s0]--
+				stack[n-2] = s0
+				stack = stack[:n-1]
+				continue
+			}
+			if head[s0] == s1 && numDeps[s0] == 0 {
+				actions = append(actions, "REDUCE-R-"+label[s0])
+				numDeps[s1]--
+				stack = stack[:n-1]
+				continue
+			}
+		}
+		if next == len(yield) {
+			panic("dependencies are not projective")
+		}
+		actions = append(actions, "SHIFT")
+		stack = append(stack, next)
+		next++
+	}
+	return actions
+}
+
+// BuildProjectiveConstituency builds a constituency tree from a
+// projective dependency tree over words with POS tags. heads[i] is the
+// position of the head of word i, or -1 for the root. Each word gets a
+// pre-terminal; each word with dependents, as well as the root word,
+// also projects a constituent that covers the word's pre-terminal and
+// the constituents of its dependents in word order. The projection of
+// word d is labeled labelFn(d, heads[d]). It returns BadHeads when the
+// slices differ in length or heads is not a tree with a single root,
+// and NonProjective when a subtree does not cover a contiguous span.
+func BuildProjectiveConstituency(words, tags []string, heads []int, labelFn func(dep, head int) string) (*ParseTree, error) {
+	n := len(words)
+	if len(tags) != n || len(heads) != n {
+		return nil, BadHeads
+	}
+	tree := &ParseTree{Topology: NewEmptyTopology()}
+	if n == 0 {
+		return tree, nil
+	}
+	root := -1
+	deps := make([][]int, n)
+	for d, h := range heads {
+		if h == -1 {
+			if root != -1 {
+				return nil, BadHeads
+			}
+			root = d
+		} else if h < 0 || h >= n || h == d {
+			return nil, BadHeads
+		} else {
+			deps[h] = append(deps[h], d)
+		}
+	}
+	if root == -1 {
+		return nil, BadHeads
+	}
+	// Compute the extent of each subtree bottom-up; a cycle leaves some
+	// words unreached.
+	var order []int
+	stack := []int{root}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		order = append(order, d)
+		stack = append(stack, deps[d]...)
+	}
+	if len(order) != n {
+		return nil, BadHeads
+	}
+	lo, hi, size := make([]int, n), make([]int, n), make([]int, n)
+	for i := n - 1; i >= 0; i-- {
+		d := order[i]
+		lo[d], hi[d], size[d] = d, d, 1
+		for _, c := range deps[d] {
+			if lo[c] < lo[d] {
+				lo[d] = lo[c]
+			}
+			if hi[c] > hi[d] {
+				hi[d] = hi[c]
+			}
+			size[d] += size[c]
+		}
+		if hi[d]-lo[d]+1 != size[d] {
+			return nil, NonProjective
+		}
+	}
+	tree.Topology.Root = buildProjection(tree, words, tags, heads, deps, labelFn, root)
+	return tree, nil
+}
+
+// buildProjection adds the nodes for word d and its dependents to tree
+// in pre-order and returns the top node.
+func buildProjection(tree *ParseTree, words, tags []string, heads []int, deps [][]int, labelFn func(dep, head int) string, d int) NodeId {
+	t := tree.Topology
+	var top NodeId
+	if len(deps[d]) != 0 || heads[d] == -1 {
+		top = t.AddNode()
+		tree.Label = append(tree.Label, labelFn(d, heads[d]))
+	}
+	preTerminal := func() NodeId {
+		tag := t.AddNode()
+		tree.Label = append(tree.Label, tags[d])
+		word := t.AddNode()
+		tree.Label = append(tree.Label, words[d])
+		t.AppendChild(tag, word)
+		return tag
+	}
+	if len(deps[d]) == 0 && heads[d] != -1 {
+		return preTerminal()
+	}
+	// deps[d] is in increasing word order.
+	placed := false
+	for _, c := range deps[d] {
+		if !placed && c > d {
+			t.AppendChild(top, preTerminal())
+			placed = true
+		}
+		t.AppendChild(top, buildProjection(tree, words, tags, heads, deps, labelFn, c))
+	}
+	if !placed {
+		t.AppendChild(top, preTerminal())
+	}
+	return top
+}
+
+// GovernorLabels returns, for each word in the order of POS, the
+// label of the constituent where the word's maximal projection
+// attaches, i.e. the constituent headed by its governor. A word
+// heading the whole tree gets "ROOT". Valid Label, HeadLeaf and POS
+// slices must present, where every POS node is a pre-terminal.
+func (tree *ParseTree) GovernorLabels() []string {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if len(tree.HeadLeaf) != t.NumNodes() {
+		panic("HeadLeaf and Topology do not match in size")
+	}
+	for _, pos := range tree.POS {
+		if pos < 0 || int(pos) >= t.NumNodes() || !t.PreTerminal(pos) {
+			panic("POS and Topology do not match")
+		}
+	}
+	parent := t.parents()
+	labels := make([]string, len(tree.POS))
+	for i, pos := range tree.POS {
+		leaf := t.Children[pos][0]
+		n := leaf
+		for parent[n] != NoNodeId && tree.HeadLeaf[parent[n]] == leaf {
+			n = parent[n]
+		}
+		if parent[n] == NoNodeId {
+			labels[i] = "ROOT"
+		} else {
+			labels[i] = tree.Label[parent[n]]
+		}
+	}
+	return labels
+}
+
+// WriteCoNLL writes the dependencies derived from HeadLeaf in the
+// CoNLL-X format: one line per word in the yield with its 1-based
+// index, the word, its POS tag (as both the coarse and the fine tag),
+// the index of its head (0 for the root) and the label of the
+// constituent where it attaches (see GovernorLabels), followed by an
+// empty line. The other columns are "_". Valid Label, Head, HeadLeaf
+// and POS slices must present, where every word is under a
+// pre-terminal; otherwise NoLabel, NoHead, NoHeadLeaf or NoPOS is
+// returned.
+func (tree *ParseTree) WriteCoNLL(w io.Writer) error {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		return NoLabel
+	}
+	if len(tree.Head) != t.NumNodes() {
+		return NoHead
+	}
+	if len(tree.HeadLeaf) != t.NumNodes() {
+		return NoHeadLeaf
+	}
+	index, yield := tree.LeafIndexMap()
+	if len(tree.POS) != len(yield) {
+		return NoPOS
+	}
+	for i, pos := range tree.POS {
+		if !t.PreTerminal(pos) || t.Children[pos][0] != yield[i] {
+			return NoPOS
+		}
+	}
+	head := make([]int, len(yield))
+	for _, a := range tree.headArcs() {
+		head[index[a.dep]] = index[a.head] + 1
+	}
+	labels := tree.GovernorLabels()
+	bw := bufio.NewWriter(w)
+	for i, leaf := range yield {
+		tag := tree.Label[tree.POS[i]]
+		fmt.Fprintf(bw, "%d\t%s\t_\t%s\t%s\t_\t%d\t%s\t_\t_\n", i+1, tree.Label[leaf], tag, tag, head[i], labels[i])
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// DependencyLengthHistogram counts the lengths (i.e. the distances in
+// words between head and dependent) of the dependency arcs derived
+// from HeadLeaf over all the trees. Valid HeadLeaf and Span slices
+// must present in every tree; otherwise NoHeadLeaf or NoSpan is
+// returned. Nil trees are skipped.
+func DependencyLengthHistogram(trees []*ParseTree) (map[int]int, error) {
+	histogram := make(map[int]int)
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		numNodes := tree.Topology.NumNodes()
+		if len(tree.HeadLeaf) != numNodes {
+			return nil, NoHeadLeaf
+		}
+		if len(tree.Span) != numNodes {
+			return nil, NoSpan
+		}
+		for _, a := range tree.headArcs() {
+			length := tree.Span[a.head].Left - tree.Span[a.dep].Left
+			if length < 0 {
+				length = -length
+			}
+			histogram[length]++
+		}
+	}
+	return histogram, nil
+}
@@ -0,0 +1,241 @@
+package treebank
+
+import (
+	"bytes"
+	"github.com/kho/nlp_basic/syntax/heads"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTreeNonProjectiveArcs(t *testing.T) {
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_INITIAL}
+
+	tree := FromString("((S (A a) (B (C c) (D d)) (E e)))")
+	if _, err := tree.NonProjectiveArcs(); err != NoHeadLeaf {
+		t.Errorf("expected %q; got %q", NoHeadLeaf, err)
+	}
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	if _, err := tree.NonProjectiveArcs(); err != NoSpan {
+		t.Errorf("expected %q; got %q", NoSpan, err)
+	}
+	tree.FillSpan()
+	if n, err := tree.NonProjectiveArcs(); n != 0 || err != nil {
+		t.Errorf("expected (0, nil); got (%d, %q)", n, err)
+	}
+
+	// Resolve a trace: e is understood at the position of the trace
+	// under B, so it takes the place of d and pushes d to the end.
+	tree = FromString("((S (A a) (B (C c) (-NONE- *T*-1)) (E-1 e)))")
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	tree.FillSpan()
+	trace, filler := NodeId(7), NodeId(9)
+	tree.Span[trace], tree.Span[filler] = tree.Span[filler], tree.Span[trace]
+	if n, err := tree.NonProjectiveArcs(); n != 1 || err != nil {
+		t.Errorf("expected (1, nil); got (%d, %q)", n, err)
+	}
+}
+
+func TestParseTreeDependencies(t *testing.T) {
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
+	tree := FromString("((S (NP-SBJ a) (VP (V b) (NP c))))")
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	var deps []string
+	for _, d := range tree.Dependencies() {
+		deps = append(deps, tree.Label[d.Head]+" -> "+tree.Label[d.Dependent])
+	}
+	if expected := []string{"c -> a", "c -> b"}; !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected %v; got %v", expected, deps)
+	}
+	tree = FromString("((A a))")
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	if deps := tree.Dependencies(); len(deps) != 0 {
+		t.Errorf("expected no dependencies; got %v", deps)
+	}
+}
+
+var shiftReduceCases = []struct {
+	input   string
+	actions []string
+}{
+	{"(())", nil},
+	{"((NP a))", []string{"SHIFT"}},
+	{"((S (NP a) (VP b)))", []string{"SHIFT", "SHIFT", "REDUCE-L-S"}},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP it))))",
+		[]string{"SHIFT", "SHIFT", "REDUCE-L-NP", "SHIFT", "REDUCE-L-S", "SHIFT", "REDUCE-R-VP"}},
+	{"((S (NP a) (VP (VBD saw) (NP (DT the) (NN cat)))))",
+		[]string{"SHIFT", "SHIFT", "REDUCE-L-S", "SHIFT", "SHIFT", "REDUCE-L-NP", "REDUCE-R-VP"}},
+}
+
+func TestParseTreeShiftReduceActions(t *testing.T) {
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	for _, c := range shiftReduceCases {
+		tree := FromString(c.input)
+		tree.FillHead(finder)
+		tree.FillHeadLeaf()
+		if actions := tree.ShiftReduceActions(); !reflect.DeepEqual(actions, c.actions) {
+			t.Errorf("expected %v; got %v for %q", c.actions, actions, c.input)
+		}
+	}
+}
+
+var projectiveConstituencyCases = []struct {
+	words, tags []string
+	heads       []int
+	output      string
+	err         error
+}{
+	{nil, nil, nil, "(())", nil},
+	{[]string{"go"}, []string{"VB"}, []int{-1}, "((S (VB go)))", nil},
+	{
+		[]string{"the", "cat", "sat", "on", "the", "mat"},
+		[]string{"DT", "NN", "VBD", "IN", "DT", "NN"},
+		[]int{1, 2, -1, 2, 5, 3},
+		"((S (NP (DT the) (NN cat)) (VBD sat) (PP (IN on) (NP (DT the) (NN mat)))))",
+		nil,
+	},
+	{[]string{"a", "b", "c", "d"}, []string{"A", "B", "C", "D"}, []int{2, 3, -1, 2}, "", NonProjective},
+	{[]string{"a", "b"}, []string{"A", "B"}, []int{-1, -1}, "", BadHeads},
+	{[]string{"a", "b", "c"}, []string{"A", "B", "C"}, []int{-1, 2, 1}, "", BadHeads},
+	{[]string{"a", "b"}, []string{"A", "B"}, []int{-1, 2}, "", BadHeads},
+	{[]string{"a", "b"}, []string{"A"}, []int{-1, 0}, "", BadHeads},
+}
+
+func TestBuildProjectiveConstituency(t *testing.T) {
+	for _, c := range projectiveConstituencyCases {
+		labelFn := func(dep, head int) string {
+			if head == -1 {
+				return "S"
+			}
+			return map[string]string{"NN": "NP", "IN": "PP"}[c.tags[dep]]
+		}
+		tree, err := BuildProjectiveConstituency(c.words, c.tags, c.heads, labelFn)
+		if err != c.err {
+			t.Errorf("expected %v; got %v for %v", c.err, err, c.heads)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		topologySanityCheck(tree.Topology, t)
+		if expected := FromString(c.output); !equiv(tree, expected) {
+			t.Errorf("expected %q; got %q for %v", expected, tree, c.heads)
+		}
+	}
+}
+
+func TestParseTreeGovernorLabels(t *testing.T) {
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	tree := FromString("((S (NP (DT the) (JJ big) (NN cat)) (VP (VBD saw) (NP (PRP it)))))")
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	tree.FillPOS()
+	expected := []string{"NP", "NP", "S", "ROOT", "VP"}
+	if labels := tree.GovernorLabels(); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v; got %v", expected, labels)
+	}
+	// Stale POS
+	tree.POS = []NodeId{0, 100}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic for stale POS")
+			}
+		}()
+		tree.GovernorLabels()
+	}()
+}
+
+func TestDependencyLengthHistogram(t *testing.T) {
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	trees := []*ParseTree{
+		// the <- cat <- sat
+		FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))"),
+		// the, big <- cat <- saw -> it
+		FromString("((S (NP (DT the) (JJ big) (NN cat)) (VP (VBD saw) (NP (PRP it)))))"),
+		nil,
+	}
+	for _, tree := range trees[:2] {
+		tree.FillHead(finder)
+		tree.FillHeadLeaf()
+	}
+	if _, err := DependencyLengthHistogram(trees); err != NoSpan {
+		t.Errorf("expected %v; got %v", NoSpan, err)
+	}
+	for _, tree := range trees[:2] {
+		tree.FillSpan()
+	}
+	histogram, err := DependencyLengthHistogram(trees)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := map[int]int{1: 5, 2: 1}
+	if !reflect.DeepEqual(histogram, expected) {
+		t.Errorf("expected %v; got %v", expected, histogram)
+	}
+	if _, err := DependencyLengthHistogram([]*ParseTree{FromString("((A a))")}); err != NoHeadLeaf {
+		t.Errorf("expected %v; got %v", NoHeadLeaf, err)
+	}
+}
+
+func TestParseTreeWriteCoNLL(t *testing.T) {
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP (PRP it)))))")
+	var buf bytes.Buffer
+	if err := tree.WriteCoNLL(&buf); err != NoHead {
+		t.Errorf("expected %v; got %v", NoHead, err)
+	}
+	tree.FillHead(finder)
+	if err := tree.WriteCoNLL(&buf); err != NoHeadLeaf {
+		t.Errorf("expected %v; got %v", NoHeadLeaf, err)
+	}
+	tree.FillHeadLeaf()
+	if err := tree.WriteCoNLL(&buf); err != NoPOS {
+		t.Errorf("expected %v; got %v", NoPOS, err)
+	}
+	tree.FillPOS()
+	if err := tree.WriteCoNLL(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "1\tthe\t_\tDT\tDT\t_\t2\tNP\t_\t_\n" +
+		"2\tcat\t_\tNN\tNN\t_\t3\tS\t_\t_\n" +
+		"3\tsaw\t_\tVBD\tVBD\t_\t0\tROOT\t_\t_\n" +
+		"4\tit\t_\tPRP\tPRP\t_\t3\tVP\t_\t_\n" +
+		"\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q; got %q", expected, buf.String())
+	}
+	if lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"); len(lines) != len(tree.Topology.Leaves()) {
+		t.Errorf("expected %d lines; got %d", len(tree.Topology.Leaves()), len(lines))
+	}
+	// Head is required even when HeadLeaf is available.
+	tree.Head = nil
+	buf.Reset()
+	if err := tree.WriteCoNLL(&buf); err != NoHead || buf.Len() != 0 {
+		t.Errorf("expected %v and no output; got %v and %q", NoHead, err, buf.String())
+	}
+}
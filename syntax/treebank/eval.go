@@ -0,0 +1,314 @@
+package treebank
+
+import (
+	"errors"
+)
+
+// TreeTooLarge is returned by TreeEditDistanceCapped when an input
+// exceeds the size cap.
+var TreeTooLarge = errors.New("tree is too large")
+
+// TreeEditDistance is TreeEditDistanceCapped without a size cap.
+func TreeEditDistance(a, b *ParseTree) int {
+	d, _ := TreeEditDistanceCapped(a, b, 0)
+	return d
+}
+
+// TreeEditDistanceCapped computes the Zhang-Shasha tree edit distance
+// between the labeled trees under the roots of a and b with unit
+// costs for inserting, deleting and relabeling a node. It takes
+// O(|a| |b|) space and O(|a|^2 |b|^2) time in the worst case (e.g. on
+// right-branching chains), so when maxNodes is positive, TreeTooLarge
+// is returned if either tree has more than maxNodes nodes. Label must
+// be valid in both trees.
+func TreeEditDistanceCapped(a, b *ParseTree, maxNodes int) (int, error) {
+	ta, tb := newPostOrderTree(a), newPostOrderTree(b)
+	if maxNodes > 0 && (len(ta.label) > maxNodes || len(tb.label) > maxNodes) {
+		return 0, TreeTooLarge
+	}
+	m, n := len(ta.label), len(tb.label)
+	if m == 0 || n == 0 {
+		return m + n, nil
+	}
+
+	treeDist := make([][]int, m)
+	for i := range treeDist {
+		treeDist[i] = make([]int, n)
+	}
+	forestDist := make([][]int, m+1)
+	for i := range forestDist {
+		forestDist[i] = make([]int, n+1)
+	}
+
+	for _, i := range ta.keyRoots() {
+		for _, j := range tb.keyRoots() {
+			// forestDist[x][y] is the distance between the forests
+			// ta[li:li+x] and tb[lj:lj+y].
+			li, lj := ta.leftmost[i], tb.leftmost[j]
+			forestDist[0][0] = 0
+			for x := 1; x <= i-li+1; x++ {
+				forestDist[x][0] = x
+			}
+			for y := 1; y <= j-lj+1; y++ {
+				forestDist[0][y] = y
+			}
+			for x := 1; x <= i-li+1; x++ {
+				i1 := li + x - 1
+				for y := 1; y <= j-lj+1; y++ {
+					j1 := lj + y - 1
+					var d int
+					if ta.leftmost[i1] == li && tb.leftmost[j1] == lj {
+						rename := 0
+						if ta.label[i1] != tb.label[j1] {
+							rename = 1
+						}
+						d = min3(forestDist[x-1][y]+1, forestDist[x][y-1]+1, forestDist[x-1][y-1]+rename)
+						treeDist[i1][j1] = d
+					} else {
+						d = min3(forestDist[x-1][y]+1, forestDist[x][y-1]+1,
+							forestDist[ta.leftmost[i1]-li][tb.leftmost[j1]-lj]+treeDist[i1][j1])
+					}
+					forestDist[x][y] = d
+				}
+			}
+		}
+	}
+	return treeDist[m-1][n-1], nil
+}
+
+// postOrderTree is the labeled tree under Root in post-order, as used
+// by the tree edit distance.
+type postOrderTree struct {
+	label    []string
+	leftmost []int // Post-order index of the leftmost leaf under each node
+}
+
+func newPostOrderTree(tree *ParseTree) *postOrderTree {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	p := &postOrderTree{}
+	if tree.Topology.Root != NoNodeId {
+		p.dfs(tree, tree.Topology.Root)
+	}
+	return p
+}
+
+func (p *postOrderTree) dfs(tree *ParseTree, n NodeId) int {
+	leftmost := -1
+	for _, child := range tree.Topology.Children[n] {
+		l := p.dfs(tree, child)
+		if leftmost < 0 {
+			leftmost = l
+		}
+	}
+	if leftmost < 0 {
+		leftmost = len(p.label)
+	}
+	p.label = append(p.label, tree.Label[n])
+	p.leftmost = append(p.leftmost, leftmost)
+	return leftmost
+}
+
+// keyRoots returns in increasing order the nodes that have no
+// ancestor sharing the same leftmost leaf.
+func (p *postOrderTree) keyRoots() []int {
+	seen := make(map[int]bool)
+	var roots []int
+	for i := len(p.label) - 1; i >= 0; i-- {
+		if !seen[p.leftmost[i]] {
+			seen[p.leftmost[i]] = true
+			roots = append(roots, i)
+		}
+	}
+	for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+		roots[i], roots[j] = roots[j], roots[i]
+	}
+	return roots
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// EvalOptions controls how Evaluate compares brackets.
+type EvalOptions struct {
+	// Canonicalize maps a label to the form used in comparison,
+	// e.g. stripping function tags so that NP-SBJ matches NP. When it
+	// is nil, labels are compared exactly.
+	Canonicalize func(string) string
+	// SkipLabels lists the labels (before Canonicalize) of the
+	// brackets that are not counted, e.g. a TOP wrapper.
+	SkipLabels []string
+	// DeleteTags lists the pre-terminal labels whose words are removed
+	// (see RemovePunctuation) from both trees before the brackets are
+	// collected, like DELETE_LABEL in EVALB.
+	DeleteTags []string
+}
+
+// Parseval holds the labeled bracket counts of a test tree against a
+// gold tree.
+type Parseval struct {
+	Matched, Gold, Test int
+}
+
+// Precision returns Matched / Test, or 0 when there is no test
+// bracket.
+func (p Parseval) Precision() float64 {
+	if p.Test == 0 {
+		return 0
+	}
+	return float64(p.Matched) / float64(p.Test)
+}
+
+// Recall returns Matched / Gold, or 0 when there is no gold bracket.
+func (p Parseval) Recall() float64 {
+	if p.Gold == 0 {
+		return 0
+	}
+	return float64(p.Matched) / float64(p.Gold)
+}
+
+// F1 returns the harmonic mean of Precision and Recall.
+func (p Parseval) F1() float64 {
+	if p.Gold+p.Test == 0 {
+		return 0
+	}
+	return 2 * float64(p.Matched) / float64(p.Gold+p.Test)
+}
+
+// Add returns the sum of two counts, e.g. for corpus-level scores.
+func (p Parseval) Add(q Parseval) Parseval {
+	return Parseval{p.Matched + q.Matched, p.Gold + q.Gold, p.Test + q.Test}
+}
+
+// bracket is a labeled constituent.
+type bracket struct {
+	label       string
+	left, right int
+}
+
+// Evaluate computes the PARSEVAL labeled bracket counts of test
+// against gold. The brackets of a tree are the labels and spans of
+// its nodes other than leaves and pre-terminals, which are matched as
+// multisets. opts may be nil for the defaults. Label must be valid in
+// both trees.
+func Evaluate(gold, test *ParseTree, opts *EvalOptions) Parseval {
+	if opts == nil {
+		opts = &EvalOptions{}
+	}
+	goldBrackets := brackets(gold, opts)
+	testBrackets := brackets(test, opts)
+	var p Parseval
+	for _, n := range goldBrackets {
+		p.Gold += n
+	}
+	for b, n := range testBrackets {
+		p.Test += n
+		if m := goldBrackets[b]; m < n {
+			p.Matched += m
+		} else {
+			p.Matched += n
+		}
+	}
+	return p
+}
+
+// Evalb computes the labeled bracket counts of test against gold
+// with the settings of COLLINS.prm in EVALB: TOP and ROOT brackets are
+// not counted, the words tagged as -NONE- or one of EvalbDeleteTags
+// are deleted, function tags are stripped (e.g. NP-SBJ is NP) and
+// ADVP and PRT are considered the same label. Label must be valid in
+// both trees.
+func Evalb(gold, test *ParseTree) (matched, goldCount, testCount int) {
+	opts := &EvalOptions{
+		Canonicalize: func(label string) string {
+			if len(label) > 0 && label[0] != '-' {
+				label = stripLabelAnnotation(label, "-=")
+			}
+			if label == "PRT" {
+				return "ADVP"
+			}
+			return label
+		},
+		SkipLabels: []string{"TOP", "ROOT"},
+		DeleteTags: EvalbDeleteTags,
+	}
+	p := Evaluate(gold, test, opts)
+	return p.Matched, p.Gold, p.Test
+}
+
+// EvalbDeleteTags are the pre-terminal labels whose words are deleted
+// by Evalb, as DELETE_LABEL in COLLINS.prm.
+var EvalbDeleteTags = []string{"-NONE-", ",", ":", "``", "''", "."}
+
+func brackets(tree *ParseTree, opts *EvalOptions) map[bracket]int {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if len(opts.DeleteTags) > 0 {
+		tree = tree.Copy().RemovePunctuation(opts.DeleteTags)
+		t = tree.Topology
+	}
+	skip := make(map[string]bool, len(opts.SkipLabels))
+	for _, label := range opts.SkipLabels {
+		skip[label] = true
+	}
+	// Compute spans without touching the tree.
+	spans := &ParseTree{Topology: t}
+	spans.FillSpan()
+	counts := make(map[bracket]int)
+	for _, n := range t.preOrder() {
+		if t.Leaf(n) || t.PreTerminal(n) || skip[tree.Label[n]] {
+			continue
+		}
+		label := tree.Label[n]
+		if opts.Canonicalize != nil {
+			label = opts.Canonicalize(label)
+		}
+		counts[bracket{label, spans.Span[n].Left, spans.Span[n].Right}]++
+	}
+	return counts
+}
+
+// YieldDiff compares the words of two trees. It returns the words
+// found only in a and only in b, counted with multiplicity and in the
+// order they appear, and the first position where the two yields
+// differ, or -1 when they are identical. Label must be valid in both
+// trees.
+func YieldDiff(a, b *ParseTree) (aOnly, bOnly []string, firstDiff int) {
+	wa, wb := a.Words(), b.Words()
+	firstDiff = -1
+	for i := 0; i < len(wa) || i < len(wb); i++ {
+		if i >= len(wa) || i >= len(wb) || wa[i] != wb[i] {
+			firstDiff = i
+			break
+		}
+	}
+	return multisetMinus(wa, wb), multisetMinus(wb, wa), firstDiff
+}
+
+// multisetMinus returns the elements of a not matched by those of b,
+// in the order of a.
+func multisetMinus(a, b []string) []string {
+	count := make(map[string]int)
+	for _, s := range b {
+		count[s]++
+	}
+	var diff []string
+	for _, s := range a {
+		if count[s] > 0 {
+			count[s]--
+		} else {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,141 @@
+package treebank
+
+import (
+	"reflect"
+	"testing"
+)
+
+var treeEditDistanceCases = []struct {
+	a, b     string
+	distance int
+}{
+	{"(())", "(())", 0},
+	{"(())", "((S (NP a) (VP b)))", 5},
+	{"((S (NP a) (VP b)))", "((S (NP a) (VP b)))", 0},
+	// Relabeling
+	{"((S (NP a) (VP b)))", "((S (NP a) (ADJP b)))", 1},
+	// Inserting a node
+	{"((S (NP a) (VP b)))", "((S (NP a) (VP (V b))))", 1},
+	{"((S (NP a) (VP b)))", "((S (NP a) (X (VP b))))", 1},
+	// Deleting a constituent
+	{"((S (NP a) (VP b) (. c)))", "((S (NP a) (VP b)))", 2},
+	{"((S (NP (DT a) (NN b)) (VP c)))", "((S (DT a) (NP (NN b) (VP c))))", 2},
+}
+
+func TestTreeEditDistance(t *testing.T) {
+	for _, c := range treeEditDistanceCases {
+		a, b := FromString(c.a), FromString(c.b)
+		if d := TreeEditDistance(a, b); d != c.distance {
+			t.Errorf("expected %d; got %d for %q vs %q", c.distance, d, c.a, c.b)
+		}
+		if d := TreeEditDistance(b, a); d != c.distance {
+			t.Errorf("expected %d; got %d for %q vs %q", c.distance, d, c.b, c.a)
+		}
+	}
+
+	a, b := FromString("((S (NP a) (VP b)))"), FromString("((S (NP a) (VP (V b))))")
+	if _, err := TreeEditDistanceCapped(a, b, 5); err != TreeTooLarge {
+		t.Errorf("expected %q; got %v", TreeTooLarge, err)
+	}
+	if d, err := TreeEditDistanceCapped(a, b, 6); d != 1 || err != nil {
+		t.Errorf("expected (1, nil); got (%d, %v)", d, err)
+	}
+}
+
+var evaluateCases = []struct {
+	gold, test            string
+	matched, numGold, num int
+}{
+	{"(())", "(())", 0, 0, 0},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (NP (DT the) (NN cat)) (VP (VBD sat))))", 3, 3, 3},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (DT the) (VP (NN cat) (VBD sat))))", 1, 3, 2},
+	{"((S (NP a) (VP (V b) (NP c))))", "((S (NP a) (VP (V b)) (NP c)))", 1, 2, 2},
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, c := range evaluateCases {
+		p := Evaluate(FromString(c.gold), FromString(c.test), nil)
+		if expected := (Parseval{c.matched, c.numGold, c.num}); p != expected {
+			t.Errorf("expected %+v; got %+v for %q vs %q", expected, p, c.gold, c.test)
+		}
+	}
+}
+
+func TestEvaluateCanonicalize(t *testing.T) {
+	gold := FromString("((S (NP-SBJ (DT the) (NN cat)) (VP (VBD sat) (ADVP-TMP (RB today)))))")
+	test := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat) (ADVP (RB today)))))")
+	if f := Evaluate(gold, test, nil).F1(); f >= 1 {
+		t.Errorf("expected F1 < 1; got %v", f)
+	}
+	opts := &EvalOptions{Canonicalize: func(label string) string {
+		return stripLabelAnnotation(label, "-=")
+	}}
+	p := Evaluate(gold, test, opts)
+	if p.Precision() != 1 || p.Recall() != 1 || p.F1() != 1 {
+		t.Errorf("expected perfect scores; got %+v", p)
+	}
+}
+
+var evalbCases = []struct {
+	gold, test                    string
+	matched, goldCount, testCount int
+}{
+	// PP attached to VP vs. NP
+	{
+		"((S (NP (PRP I)) (VP (VBD saw) (NP (DT the) (NN man)) (PP (IN with) (NP (DT a) (NN telescope)))) (. .)))",
+		"((S (NP (PRP I)) (VP (VBD saw) (NP (NP (DT the) (NN man)) (PP (IN with) (NP (DT a) (NN telescope))))) (. .)))",
+		6, 6, 7,
+	},
+	// Punctuation is deleted before spans are computed.
+	{
+		"((S (NP (NNP John)) (, ,) (VP (VBD left))))",
+		"((S (NP (NP (NNP John)) (, ,)) (VP (VBD left))))",
+		3, 3, 4,
+	},
+	// Brackets are kept.
+	{
+		"((S (NP (NNP John)) (PRN (-LRB- -LRB-) (NP (NNP J.)) (-RRB- -RRB-)) (VP (VBD left))))",
+		"((S (NP (NP (NNP John)) (PRN (-LRB- -LRB-) (NP (NNP J.)) (-RRB- -RRB-))) (VP (VBD left))))",
+		5, 5, 6,
+	},
+	// TOP is not counted and empty elements are deleted.
+	{"((TOP (S (NP-SBJ (-NONE- *)) (VP (VBD left)))))", "((S (VP (VBD left))))", 2, 2, 2},
+	// Function tags are stripped and ADVP matches PRT.
+	{"((S (NP-SBJ (PRP I)) (VP (VBD gave) (PRT (RP up)))))", "((S (NP (PRP I)) (VP (VBD gave) (ADVP (RP up)))))", 4, 4, 4},
+}
+
+func TestEvalb(t *testing.T) {
+	for _, c := range evalbCases {
+		gold, test := FromString(c.gold), FromString(c.test)
+		matched, goldCount, testCount := Evalb(gold, test)
+		if matched != c.matched || goldCount != c.goldCount || testCount != c.testCount {
+			t.Errorf("expected (%d, %d, %d); got (%d, %d, %d) for %q vs %q",
+				c.matched, c.goldCount, c.testCount, matched, goldCount, testCount, c.gold, c.test)
+		}
+		if gold.String() != c.gold || test.String() != c.test {
+			t.Errorf("expected the trees to be untouched; got %q and %q", gold, test)
+		}
+	}
+}
+
+var yieldDiffCases = []struct {
+	a, b         string
+	aOnly, bOnly []string
+	firstDiff    int
+}{
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (NP (DT the) (NN cat)) (VP (VBD sat))))", nil, nil, -1},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (NP (NN cat)) (VP (VBD sat))))", []string{"the"}, nil, 0},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (NP (DT the) (NN cat)) (VP (VBD sat)) (. .)))", nil, []string{"."}, 3},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "((S (NP (DT the) (NN dog)) (VP (VBD sat))))", []string{"cat"}, []string{"dog"}, 1},
+	{"((S (NP (DT a) (NN b)) (VP (VBD a))))", "((S (NP (DT b) (NN a)) (VP (VBD a))))", nil, nil, 0},
+	{"(())", "(())", nil, nil, -1},
+}
+
+func TestYieldDiff(t *testing.T) {
+	for _, c := range yieldDiffCases {
+		aOnly, bOnly, firstDiff := YieldDiff(FromString(c.a), FromString(c.b))
+		if !reflect.DeepEqual(aOnly, c.aOnly) || !reflect.DeepEqual(bOnly, c.bOnly) || firstDiff != c.firstDiff {
+			t.Errorf("expected %v, %v and %d; got %v, %v and %d for %q vs %q", c.aOnly, c.bOnly, c.firstDiff, aOnly, bOnly, firstDiff, c.a, c.b)
+		}
+	}
+}
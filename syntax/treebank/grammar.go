@@ -0,0 +1,185 @@
+package treebank
+
+import (
+	"errors"
+	"github.com/kho/nlp_basic/bimap"
+	"strings"
+)
+
+// BadMarkovOrder is returned when a markov order for binarization is
+// out of range.
+var BadMarkovOrder = errors.New("invalid markov order")
+
+// Production is a CFG rule read off an internal node of a tree.
+type Production struct {
+	Parent   string
+	Children []string
+}
+
+// String formats the production as "parent -> child1 child2 ...".
+func (p Production) String() string {
+	return productionString(p.Parent, p.Children)
+}
+
+// Productions returns the production at every internal node of the
+// tree in pre-order, lexical ones (i.e. from pre-terminals to words)
+// included. Label must be valid.
+func (tree *ParseTree) Productions() []Production {
+	var prods []Production
+	tree.ForEachProduction(true, func(parent string, children []string) {
+		prods = append(prods, Production{parent, append([]string(nil), children...)})
+	})
+	return prods
+}
+
+// ForEachProduction calls f with the production at every internal
+// node of the tree in pre-order, skipping lexical ones (i.e. from
+// pre-terminals to words) unless includeLexical is true. The children
+// slice is reused across calls and is only valid during the call.
+// Label must be valid.
+func (tree *ParseTree) ForEachProduction(includeLexical bool, f func(parent string, children []string)) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if t.Root == NoNodeId {
+		return
+	}
+	children := make([]string, 0, 16)
+	for _, node := range t.preOrder() {
+		if t.Leaf(node) || !includeLexical && t.PreTerminal(node) {
+			continue
+		}
+		children = children[:0]
+		for _, child := range t.Children[node] {
+			children = append(children, tree.Label[child])
+		}
+		f(tree.Label[node], children)
+	}
+}
+
+// CountProductions counts the productions (see Productions) of all
+// the trees, keyed by their string forms (see Production.String), e.g.
+// for estimating a PCFG by relative frequency. Label must be valid in
+// every tree. Nil trees are skipped.
+func CountProductions(trees []*ParseTree) map[string]int {
+	counts := make(map[string]int)
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		tree.ForEachProduction(true, func(parent string, children []string) {
+			counts[productionString(parent, children)]++
+		})
+	}
+	return counts
+}
+
+// Grammar is a collection of productions with counts. Each distinct
+// production is interned by its string form in Map, whose id indexes
+// Rules and Counts.
+type Grammar struct {
+	Map    *bimap.Map
+	Rules  []Production
+	Counts []int
+}
+
+// NewGrammar creates an empty grammar.
+func NewGrammar() *Grammar {
+	return &Grammar{Map: bimap.New()}
+}
+
+// Add adds one occurrence of p to the grammar and returns its id.
+func (g *Grammar) Add(p Production) int32 {
+	id := g.Map.Add(p.String())
+	if int(id) == len(g.Rules) {
+		g.Rules = append(g.Rules, p)
+		g.Counts = append(g.Counts, 0)
+	}
+	g.Counts[id]++
+	return id
+}
+
+// AddTree adds all the productions of tree to the grammar. Label must
+// be valid.
+func (g *Grammar) AddTree(tree *ParseTree) {
+	for _, p := range tree.Productions() {
+		g.Add(p)
+	}
+}
+
+// ExtractCNFGrammar extracts a grammar whose rules are at most binary
+// from trees. Each tree is copied and markov binarized (see
+// markovBinarize) with horizontal order h >= 0 and vertical order v
+// >= 1, so the trees themselves are not modified. Label must be valid
+// in every tree; nil trees are skipped.
+func ExtractCNFGrammar(trees []*ParseTree, h, v int) (*Grammar, error) {
+	if h < 0 || v < 1 {
+		return nil, BadMarkovOrder
+	}
+	g := NewGrammar()
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		if len(tree.Label) != tree.Topology.NumNodes() {
+			return nil, NoLabel
+		}
+		binarized := tree.Copy()
+		binarized.markovBinarize(h, v)
+		g.AddTree(binarized)
+	}
+	return g, nil
+}
+
+// markovBinarize left-factors every node with more than two children
+// and annotates phrasal labels with their ancestors.
+//
+// With vertical order v, the label of each node that is neither a
+// leaf nor a pre-terminal is suffixed by the labels of up to v-1 of
+// its ancestors, nearest first, e.g. "NP^S" for v = 2.
+//
+// A node X -> A B C D is then rewritten as X -> @X|C D, @X|C -> @X|B
+// C, @X|B -> A B (here with horizontal order h = 1), where each
+// intermediate node is labeled by X and the labels of up to h of the
+// rightmost children it covers. Label must be valid; the other
+// annotations are dropped and the tree is topologically sorted.
+func (tree *ParseTree) markovBinarize(h, v int) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	numNodes := t.NumNodes()
+	if v > 1 {
+		parent := t.parents()
+		label := make([]string, numNodes)
+		copy(label, tree.Label)
+		for n := 0; n < numNodes; n++ {
+			node := NodeId(n)
+			if t.Leaf(node) || t.PreTerminal(node) {
+				continue
+			}
+			p := parent[node]
+			for i := 1; i < v && p != NoNodeId; i++ {
+				label[node] += "^" + tree.Label[p]
+				p = parent[p]
+			}
+		}
+		tree.Label = label
+	}
+	tree.factor(LEFT_FACTORED, func(node NodeId, covered []NodeId) string {
+		if len(covered) > h {
+			covered = covered[len(covered)-h:]
+		}
+		labels := make([]string, len(covered))
+		for i, c := range covered {
+			labels[i] = tree.Label[c]
+		}
+		return "@" + tree.Label[node] + "|" + strings.Join(labels, "_")
+	})
+	tree.Map = nil
+	tree.Id = nil
+	tree.Role = nil
+	tree.clearStructure()
+	tree.Topsort()
+}
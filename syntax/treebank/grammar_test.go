@@ -0,0 +1,131 @@
+package treebank
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTreeProductions(t *testing.T) {
+	tree := FromString("((S (NP a) (VP b)))")
+	expected := []Production{
+		{"S", []string{"NP", "VP"}},
+		{"NP", []string{"a"}},
+		{"VP", []string{"b"}},
+	}
+	if prods := tree.Productions(); !reflect.DeepEqual(prods, expected) {
+		t.Errorf("expected %v; got %v", expected, prods)
+	}
+	if prods := FromString("(())").Productions(); len(prods) != 0 {
+		t.Errorf("expected no production; got %v", prods)
+	}
+}
+
+func TestParseTreeForEachProduction(t *testing.T) {
+	tree := FromString("((S (NP (DT a) (NN b)) (VP (V c) (NP (DT a) (NN b)))))")
+	counts := make(map[string]int)
+	tree.ForEachProduction(true, func(parent string, children []string) {
+		counts[productionString(parent, children)]++
+	})
+	expected := make(map[string]int)
+	for _, p := range tree.Productions() {
+		expected[p.String()]++
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+
+	counts = make(map[string]int)
+	tree.ForEachProduction(false, func(parent string, children []string) {
+		counts[productionString(parent, children)]++
+	})
+	expected = map[string]int{"S -> NP VP": 1, "NP -> DT NN": 2, "VP -> V NP": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+}
+
+func TestCountProductions(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP a) (VP b)))"),
+		nil,
+		FromString("((S (NP c) (VP (V d) (NP a))))"),
+	}
+	expected := map[string]int{
+		"S -> NP VP": 2,
+		"NP -> a":    2,
+		"NP -> c":    1,
+		"VP -> b":    1,
+		"VP -> V NP": 1,
+		"V -> d":     1,
+	}
+	if counts := CountProductions(trees); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v; got %v", expected, counts)
+	}
+}
+
+var markovBinarizeCases = []struct {
+	input  string
+	h, v   int
+	output string
+}{
+	{"((S (A a) (B b)))", 1, 1, "((S (A a) (B b)))"},
+	{"((S (A a) (B b) (C c) (D d)))", 1, 1, "((S (@S|C (@S|B (A a) (B b)) (C c)) (D d)))"},
+	{"((S (A a) (B b) (C c) (D d)))", 0, 1, "((S (@S| (@S| (A a) (B b)) (C c)) (D d)))"},
+	{"((S (A a) (B b) (C c)))", 2, 1, "((S (@S|A_B (A a) (B b)) (C c)))"},
+	{"((S (NP (DT a) (NN b)) (VP (V c))))", 0, 2, "((S (NP^S (DT a) (NN b)) (VP^S (V c))))"},
+	{"((S (X (A a) (B b) (C c))))", 1, 2, "((S (X^S (@X^S|B (A a) (B b)) (C c))))"},
+}
+
+func TestParseTreeMarkovBinarize(t *testing.T) {
+	for _, c := range markovBinarizeCases {
+		tree := FromString(c.input)
+		tree.markovBinarize(c.h, c.v)
+		topologySanityCheck(tree.Topology, t)
+		if s := tree.String(); s != c.output {
+			t.Errorf("expected %q; got %q for %q with h = %d, v = %d", c.output, s, c.input, c.h, c.v)
+		}
+	}
+}
+
+func TestExtractCNFGrammar(t *testing.T) {
+	trees := []*ParseTree{
+		FromString("((S (NP (DT the) (JJ big) (JJ red) (NN dog)) (VP (VBD barked))))"),
+		FromString("((S (NP (NN dogs)) (VP (VBD bark) (ADVP (RB loudly)) (PP (IN at) (NP (NN night))))))"),
+	}
+	saved := trees[0].String()
+	g, err := ExtractCNFGrammar(trees, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s := trees[0].String(); s != saved {
+		t.Errorf("expected unmodified %q; got %q", saved, s)
+	}
+	if len(g.Rules) != len(g.Counts) || len(g.Rules) != int(g.Map.Size()) {
+		t.Fatalf("inconsistent grammar sizes %d, %d and %d", len(g.Rules), len(g.Counts), g.Map.Size())
+	}
+	for i, rule := range g.Rules {
+		if n := len(rule.Children); n != 1 && n != 2 {
+			t.Errorf("expected binary, unary or lexical rule; got %q", rule)
+		}
+		if g.Counts[i] <= 0 {
+			t.Errorf("expected positive count; got %d for %q", g.Counts[i], rule)
+		}
+	}
+	if id := g.Map.FindByString("NP^S -> @NP^S|JJ NN"); id < 0 || g.Counts[id] != 1 {
+		t.Errorf("expected rule NP^S -> @NP^S|JJ NN once")
+	}
+	if id := g.Map.FindByString("VBD -> bark"); id < 0 || g.Counts[id] != 1 {
+		t.Errorf("expected rule VBD -> bark once")
+	}
+
+	if _, err := ExtractCNFGrammar(trees, -1, 1); err != BadMarkovOrder {
+		t.Errorf("expected %v; got %v", BadMarkovOrder, err)
+	}
+	if _, err := ExtractCNFGrammar(trees, 1, 0); err != BadMarkovOrder {
+		t.Errorf("expected %v; got %v", BadMarkovOrder, err)
+	}
+	bad := &ParseTree{Topology: NewRootedTopology()}
+	if _, err := ExtractCNFGrammar([]*ParseTree{bad}, 1, 1); err != NoLabel {
+		t.Errorf("expected %v; got %v", NoLabel, err)
+	}
+}
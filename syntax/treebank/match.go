@@ -0,0 +1,67 @@
+package treebank
+
+import (
+	"errors"
+	"strings"
+)
+
+// BadPattern is returned by Match when the pattern is not in the
+// supported subset.
+var BadPattern = errors.New("unsupported pattern")
+
+// Match finds the nodes under Root that match a pattern in a minimal
+// subset of the Tregex syntax and returns them in pre-order. The
+// supported patterns are (tokens separated by white space),
+//
+//	A        a node labeled A
+//	A < B    a node labeled A that is the parent of a node labeled B
+//	A << B   a node labeled A that dominates a node labeled B
+//
+// where labels are matched exactly. Label must be valid.
+func (tree *ParseTree) Match(pattern string) ([]NodeId, error) {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	fields := strings.Fields(pattern)
+	var match func(NodeId) bool
+	switch {
+	case len(fields) == 1:
+		match = func(NodeId) bool { return true }
+	case len(fields) == 3 && fields[1] == "<":
+		b := fields[2]
+		match = func(n NodeId) bool {
+			for _, child := range tree.Topology.Children[n] {
+				if tree.Label[child] == b {
+					return true
+				}
+			}
+			return false
+		}
+	case len(fields) == 3 && fields[1] == "<<":
+		b := fields[2]
+		// dominates[n] is true when some node strictly under n is
+		// labeled b; filled bottom-up.
+		dominates := make([]bool, tree.Topology.NumNodes())
+		nodes := tree.Topology.preOrder()
+		for i := len(nodes) - 1; i >= 0; i-- {
+			n := nodes[i]
+			for _, child := range tree.Topology.Children[n] {
+				if dominates[child] || tree.Label[child] == b {
+					dominates[n] = true
+					break
+				}
+			}
+		}
+		match = func(n NodeId) bool { return dominates[n] }
+	default:
+		return nil, BadPattern
+	}
+	a := fields[0]
+	var nodes []NodeId
+	for _, n := range tree.Topology.preOrder() {
+		if tree.Label[n] == a && match(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
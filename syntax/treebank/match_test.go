@@ -0,0 +1,42 @@
+package treebank
+
+import (
+	"reflect"
+	"testing"
+)
+
+var matchCases = []struct {
+	pattern string
+	nodes   []NodeId
+	err     error
+}{
+	{"S < NP", []NodeId{0}, nil},
+	{"S < VP", []NodeId{0}, nil},
+	{"S < V", nil, nil},
+	{"S << V", []NodeId{0}, nil},
+	{"VP < NP", nil, nil},
+	{"VP << NP", []NodeId{6}, nil},
+	{"NP", []NodeId{1, 12}, nil},
+	{"NP < DT", []NodeId{1, 12}, nil},
+	{"  PP   <<  mat ", []NodeId{9}, nil},
+	{"X", nil, nil},
+	{"", nil, BadPattern},
+	{"S <", nil, BadPattern},
+	{"S > NP", nil, BadPattern},
+	{"S < NP < DT", nil, BadPattern},
+}
+
+func TestParseTreeMatch(t *testing.T) {
+	// S:0 NP:1 DT:2 the:3 NN:4 cat:5 VP:6 V:7 sat:8 PP:9 IN:10 on:11
+	// NP:12 DT:13 the:14 NN:15 mat:16
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (V sat) (PP (IN on) (NP (DT the) (NN mat))))))")
+	for _, c := range matchCases {
+		nodes, err := tree.Match(c.pattern)
+		if err != c.err {
+			t.Errorf("expected %v; got %v for %q", c.err, err, c.pattern)
+		}
+		if !reflect.DeepEqual(nodes, c.nodes) {
+			t.Errorf("expected %v; got %v for %q", c.nodes, nodes, c.pattern)
+		}
+	}
+}
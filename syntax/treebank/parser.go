@@ -3,6 +3,7 @@ package treebank
 import (
 	"errors"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -14,8 +15,21 @@ var (
 	NoCategory        = errors.New("expect category")
 	NoWordOrOpenParen = errors.New("expect word or (")
 	ResidualInput     = errors.New("residual input")
+	NoLength          = errors.New("expect yield length")
+	LengthMismatch    = errors.New("yield length does not match")
+	NoTag             = errors.New("expect word and tag")
 )
 
+// isParseError tells whether err is one of the parsing errors above
+// rather than an IO error from the input.
+func isParseError(err error) bool {
+	switch err {
+	case ParseError, NoCloseParen, NoOpenParen, NoCategory, NoWordOrOpenParen, ResidualInput, NoLength, LengthMismatch, NoTag:
+		return true
+	}
+	return false
+}
+
 // ParseString parses a single string to extract one tree with only
 // its topology and labels and discards the rest of the string.
 func ParseString(input string) (*ParseTree, error) {
@@ -53,9 +67,137 @@ func ParseAll(input io.ByteScanner) (trees []*ParseTree, err error) {
 	return
 }
 
+// ParseUpTo is like ParseAll but stops after limit trees. more tells
+// whether there is any input other than white spaces left after the
+// trees; the input is positioned right before it.
+func ParseUpTo(input io.ByteScanner, limit int) (trees []*ParseTree, more bool, err error) {
+	p := NewParser(input)
+	for len(trees) < limit {
+		var tree *ParseTree
+		tree, err = p.Next()
+		if err == io.EOF {
+			return trees, false, nil
+		}
+		if err != nil {
+			return
+		}
+		trees = append(trees, tree)
+	}
+	c, err := input.ReadByte()
+	for err == nil && (c == ' ' || c == '\t' || c == '\n') {
+		c, err = input.ReadByte()
+	}
+	if err == io.EOF {
+		return trees, false, nil
+	}
+	if err != nil {
+		return
+	}
+	input.UnreadByte()
+	return trees, true, nil
+}
+
+// ParseTaggedLine builds a flat tree from a line of white-space
+// separated tagged tokens such as "the/DT cat/NN", where the word and
+// the tag of a token are split at the last occurrence of sep. The
+// root, labeled "ROOT", has one pre-terminal per token with the tag
+// over the word. A blank line gives the empty tree. It returns NoTag
+// when a token has no sep or an empty word or tag.
+func ParseTaggedLine(line, sep string) (*ParseTree, error) {
+	tokens := strings.Fields(line)
+	tree := &ParseTree{Topology: NewEmptyTopology()}
+	if len(tokens) == 0 {
+		return tree, nil
+	}
+	t := tree.Topology
+	root := t.AddNode()
+	t.Root = root
+	tree.Label = make([]string, 1, 1+2*len(tokens))
+	tree.Label[root] = "ROOT"
+	for _, token := range tokens {
+		i := strings.LastIndex(token, sep)
+		if i <= 0 || i+len(sep) == len(token) {
+			return nil, NoTag
+		}
+		tag, word := t.AddNode(), t.AddNode()
+		tree.Label = append(tree.Label, token[i+len(sep):], token[:i])
+		t.AppendChild(root, tag)
+		t.AppendChild(tag, word)
+	}
+	return tree, nil
+}
+
+// BatchReader reads trees from a Parser in fixed-size batches.
+type BatchReader struct {
+	// SkipEmpty makes NextBatch drop empty trees (i.e. "(())") instead
+	// of returning them.
+	SkipEmpty bool
+
+	parser *Parser
+}
+
+// NewBatchReader creates a BatchReader that reads from p.
+func NewBatchReader(p *Parser) *BatchReader {
+	return &BatchReader{parser: p}
+}
+
+// NextBatch reads the next n trees. Fewer trees are returned only at
+// the end of input; once the input is exhausted, it returns no tree
+// and io.EOF. On a parse error, the trees read before the error are
+// returned together with the error.
+func (r *BatchReader) NextBatch(n int) ([]*ParseTree, error) {
+	batch := make([]*ParseTree, 0, n)
+	for len(batch) < n {
+		tree, err := r.parser.Next()
+		if err == io.EOF {
+			if len(batch) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return batch, err
+		}
+		if r.SkipEmpty && tree.Topology.Root == NoNodeId {
+			continue
+		}
+		batch = append(batch, tree)
+	}
+	return batch, nil
+}
+
+// Modes of handling the yield length token that some tools emit
+// after each label, e.g. "((S 2 (NP 1 a) (VP 1 b)))".
+const (
+	// There is no length token.
+	LENGTH_NONE = iota
+	// The length token is read and discarded.
+	LENGTH_DISCARD
+	// The length token is read and checked against the actual yield.
+	LENGTH_VALIDATE
+)
+
 // Parser parses treebank trees from a io.ByteScanner.
 type Parser struct {
+	// LengthMode is one of the LENGTH_* constants. The default is
+	// LENGTH_NONE.
+	LengthMode int
+	// MultiWordPreTerminals allows a pre-terminal to have several words
+	// as its children, e.g. "(NN foo bar)". Such nodes are recognized
+	// by Topology.PreTerminalMulti.
+	MultiWordPreTerminals bool
+	// FoldCase lowercases all labels (categories and words) as they
+	// are read, so that anything built from the labels afterwards
+	// (e.g. the Id from RemapByLabel) only sees the folded forms.
+	FoldCase bool
+
 	input io.ByteScanner
+	// number of leaves created so far
+	numLeaves int
+	// number of unmatched '(' read from input
+	depth int
+	// number of bytes read from input
+	consumed int64
 	// tokenizer information
 	peek  bool
 	token []byte
@@ -83,6 +225,28 @@ func (p *Parser) Next() (*ParseTree, error) {
 	return tree, nil
 }
 
+// Consumed returns the number of bytes read from the input so far.
+// Right after Next returns a tree, this is the offset just past the
+// tree's closing parenthesis.
+func (p *Parser) Consumed() int64 {
+	return p.consumed
+}
+
+// Recover skips the rest of the current top-level bracket after Next
+// returns a parse error, so that the following Next starts from the
+// next tree. It returns the IO error (e.g. io.EOF) when the input ends
+// before the bracket is closed. Note that a tree with unbalanced
+// parentheses may cause the trees after it to be skipped as well.
+func (p *Parser) Recover() error {
+	p.peek = false
+	for p.depth > 0 {
+		if _, _, err := p.nextToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // parseS is the entry point of the following recursive descent parser
 // (note the grammar is stricter than ordinary sexp because of the
 // constraints in Treebank trees):
@@ -172,7 +336,21 @@ func (p *Parser) parseNode(tree *ParseTree) (NodeId, error) {
 
 	// Create the node
 	node := tree.Topology.AddNode()
-	tree.Label = append(tree.Label, string(token))
+	tree.Label = append(tree.Label, p.label(token))
+
+	// Optional yield length
+	length := 0
+	if p.LengthMode != LENGTH_NONE {
+		token, kind, err = p.nextToken()
+		if err != nil || kind != kWord {
+			return NoNodeId, NoLength
+		}
+		length, err = strconv.Atoi(string(token))
+		if err != nil || length < 0 {
+			return NoNodeId, NoLength
+		}
+	}
+	numLeaves := p.numLeaves
 
 	// ( or word
 	_, kind, err = p.peekToken()
@@ -185,8 +363,20 @@ func (p *Parser) parseNode(tree *ParseTree) (NodeId, error) {
 		// This is a pre-terminal
 		token, _, _ := p.nextToken()
 		child := tree.Topology.AddNode()
-		tree.Label = append(tree.Label, string(token))
+		tree.Label = append(tree.Label, p.label(token))
 		tree.Topology.AppendChild(node, child)
+		p.numLeaves++
+		for p.MultiWordPreTerminals {
+			_, kind, err = p.peekToken()
+			if err != nil || kind != kWord {
+				break
+			}
+			token, _, _ := p.nextToken()
+			child := tree.Topology.AddNode()
+			tree.Label = append(tree.Label, p.label(token))
+			tree.Topology.AppendChild(node, child)
+			p.numLeaves++
+		}
 	case kOpen:
 		// This is a non-terminal
 		children, err := p.parseChildren(tree)
@@ -200,9 +390,21 @@ func (p *Parser) parseNode(tree *ParseTree) (NodeId, error) {
 		return NoNodeId, err
 	}
 
+	if p.LengthMode == LENGTH_VALIDATE && p.numLeaves-numLeaves != length {
+		return NoNodeId, LengthMismatch
+	}
+
 	return node, nil
 }
 
+// label converts a token to a label.
+func (p *Parser) label(token []byte) string {
+	if p.FoldCase {
+		return strings.ToLower(string(token))
+	}
+	return string(token)
+}
+
 // parseChildren parses a list of children using the following rule,
 //   Children -> '(' Node ')' { eps | Children }
 // It returns a slice of children node ids or any error. The caller
@@ -277,9 +479,9 @@ func (p *Parser) nextToken() (token []byte, kind kind, err error) {
 		return
 	}
 	// Skip spaces
-	c, err := p.input.ReadByte()
+	c, err := p.readByte()
 	for err == nil && (c == ' ' || c == '\t' || c == '\n') {
-		c, err = p.input.ReadByte()
+		c, err = p.readByte()
 	}
 	if err != nil {
 		return
@@ -289,17 +491,21 @@ func (p *Parser) nextToken() (token []byte, kind kind, err error) {
 	p.token[0] = c
 	if c == '(' {
 		kind = kOpen
+		p.depth++
 	} else if c == ')' {
 		kind = kClose
+		if p.depth > 0 {
+			p.depth--
+		}
 	} else {
 		// Continue until a white-space or parentheses
-		c, err = p.input.ReadByte()
+		c, err = p.readByte()
 		for err == nil && c != ' ' && c != '\t' && c != '\n' && c != '(' && c != ')' {
 			p.token = append(p.token, c)
-			c, err = p.input.ReadByte()
+			c, err = p.readByte()
 		}
 		if err == nil {
-			p.input.UnreadByte()
+			p.unreadByte()
 		} else {
 			// We have successfully read something; postpone this error.
 			err = nil
@@ -309,3 +515,19 @@ func (p *Parser) nextToken() (token []byte, kind kind, err error) {
 	token = p.token
 	return
 }
+
+// readByte reads a byte from input and counts it as consumed.
+func (p *Parser) readByte() (byte, error) {
+	c, err := p.input.ReadByte()
+	if err == nil {
+		p.consumed++
+	}
+	return c, err
+}
+
+// unreadByte unreads the last byte read by readByte.
+func (p *Parser) unreadByte() {
+	if p.input.UnreadByte() == nil {
+		p.consumed--
+	}
+}
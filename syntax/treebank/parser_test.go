@@ -3,6 +3,7 @@ package treebank
 import (
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -78,7 +79,7 @@ func TestParserPeekPeekNext(t *testing.T) {
 			s2 := string(b2)
 			if s1 != s2 || k1 != k2 || e1 != e2 {
 				t.Errorf("Peek and Next gave different results: (%q, %v, %q) vs (%q, %v, %q) at input %q, token %d\n",
-					s1, k1, e1, 2, k2, e2, formatInput(c.input, input), i)
+					s1, k1, e1, s2, k2, e2, formatInput(c.input, input), i)
 			}
 			s := c.tokens[i]
 			if s2 != s {
@@ -236,6 +237,222 @@ func TestFromString(t *testing.T) {
 	}
 }
 
+var parseUpToCases = []struct {
+	input    string
+	limit    int
+	numTrees int
+	more     bool
+}{
+	{"((A a)) ((B b)) (()) ((D d)) ((E e))", 3, 3, true},
+	{"((A a)) ((B b)) (()) ((D d)) ((E e))", 5, 5, false},
+	{"((A a)) ((B b)) (()) ((D d)) ((E e))\n\n", 5, 5, false},
+	{"((A a)) ((B b)) (()) ((D d)) ((E e))", 10, 5, false},
+	{"((A a))", 0, 0, true},
+	{"", 1, 0, false},
+}
+
+func TestParseUpTo(t *testing.T) {
+	for _, c := range parseUpToCases {
+		input := strings.NewReader(c.input)
+		trees, more, err := ParseUpTo(input, c.limit)
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if len(trees) != c.numTrees || more != c.more {
+			t.Errorf("expected %d trees and %v; got %d and %v for %q with limit %d", c.numTrees, c.more, len(trees), more, c.input, c.limit)
+		}
+	}
+
+	input := strings.NewReader("((A a)) ((B b)) ((C c")
+	trees, more, err := ParseUpTo(input, 2)
+	if len(trees) != 2 || !more || err != nil {
+		t.Errorf("expected 2 trees, true and nil; got %d, %v and %v", len(trees), more, err)
+	}
+	// The rest of the input is left intact.
+	if c, _ := input.ReadByte(); c != '(' {
+		t.Errorf("expected '('; got %q", c)
+	}
+	input.UnreadByte()
+	if _, _, err := ParseUpTo(input, 2); err != NoCloseParen {
+		t.Errorf("expected %v; got %v", NoCloseParen, err)
+	}
+}
+
+var parseTaggedLineCases = []struct {
+	line, sep string
+	output    string
+	err       error
+}{
+	{"the/DT cat/NN", "/", "((ROOT (DT the) (NN cat)))", nil},
+	{"  the/DT\tcat/NN  \n", "/", "((ROOT (DT the) (NN cat)))", nil},
+	{"1/2/CD km_NN", "/", "", NoTag},
+	{"1/2/CD", "/", "((ROOT (CD 1/2)))", nil},
+	{"the_DT cat__NN", "_", "((ROOT (DT the) (NN cat_)))", nil},
+	{"the||DT a|b||NN", "||", "((ROOT (DT the) (NN a|b)))", nil},
+	{"", "/", "(())", nil},
+	{"the/DT cat", "/", "", NoTag},
+	{"/DT", "/", "", NoTag},
+	{"the/", "/", "", NoTag},
+}
+
+func TestParseTaggedLine(t *testing.T) {
+	for _, c := range parseTaggedLineCases {
+		tree, err := ParseTaggedLine(c.line, c.sep)
+		if err != c.err {
+			t.Errorf("expected %v; got %v for %q", c.err, err, c.line)
+		}
+		if err == nil && !equiv(tree, FromString(c.output)) {
+			t.Errorf("expected %q; got %q for %q", c.output, tree, c.line)
+		}
+	}
+}
+
+func TestBatchReader(t *testing.T) {
+	input := "((A a)) (()) ((B b)) ((C c)) ((D d))"
+	r := NewBatchReader(NewParser(strings.NewReader(input)))
+	for _, size := range []int{2, 2, 1} {
+		batch, err := r.NextBatch(2)
+		if err != nil {
+			t.Errorf("expected nil; got %q", err)
+		}
+		if len(batch) != size {
+			t.Errorf("expected %d trees; got %d", size, len(batch))
+		}
+	}
+	if batch, err := r.NextBatch(2); len(batch) != 0 || err != io.EOF {
+		t.Errorf("expected EOF; got %v, %v", batch, err)
+	}
+
+	r = NewBatchReader(NewParser(strings.NewReader(input)))
+	r.SkipEmpty = true
+	for _, size := range []int{2, 2} {
+		batch, err := r.NextBatch(2)
+		if err != nil {
+			t.Errorf("expected nil; got %q", err)
+		}
+		if len(batch) != size {
+			t.Errorf("expected %d trees; got %d", size, len(batch))
+		}
+		for _, tree := range batch {
+			if tree.Topology.Root == NoNodeId {
+				t.Errorf("expected no empty tree; got %v", batch)
+			}
+		}
+	}
+	if batch, err := r.NextBatch(2); len(batch) != 0 || err != io.EOF {
+		t.Errorf("expected EOF; got %v, %v", batch, err)
+	}
+
+	r = NewBatchReader(NewParser(strings.NewReader("((A a)) ((B")))
+	if batch, err := r.NextBatch(2); len(batch) != 1 || err == nil || err == io.EOF {
+		t.Errorf("expected one tree and a parse error; got %v, %v", batch, err)
+	}
+}
+
+var lengthCases = []struct {
+	input string
+	mode  int
+	tree  string
+	err   error
+}{
+	{"((S 3 (NP 1 the) (VP 2 (V 1 saw) (NP 1 it))))", LENGTH_VALIDATE, "((S (NP the) (VP (V saw) (NP it))))", nil},
+	{"((S 3 (NP 1 the) (VP 2 (V 1 saw) (NP 1 it))))", LENGTH_DISCARD, "((S (NP the) (VP (V saw) (NP it))))", nil},
+	{"((S 3 (NP 1 the) (VP 1 (V 1 saw) (NP 1 it))))", LENGTH_DISCARD, "((S (NP the) (VP (V saw) (NP it))))", nil},
+	{"((S 3 (NP 1 the) (VP 1 (V 1 saw) (NP 1 it))))", LENGTH_VALIDATE, "", LengthMismatch},
+	{"((S 3 (NP 1 the) (VP (V 1 saw) (NP 1 it))))", LENGTH_VALIDATE, "", NoLength},
+	{"((S x (NP the)))", LENGTH_DISCARD, "", NoLength},
+}
+
+func TestParserLength(t *testing.T) {
+	for _, c := range lengthCases {
+		parser := NewParser(strings.NewReader(c.input))
+		parser.LengthMode = c.mode
+		tree, err := parser.Next()
+		if err != c.err {
+			t.Errorf("expected %v; got %v at input %q", c.err, err, c.input)
+		}
+		if err == nil && !equiv(tree, FromString(c.tree)) {
+			t.Errorf("expected %q; got %q at input %q", c.tree, tree, c.input)
+		}
+	}
+}
+
+func TestParserMultiWordPreTerminals(t *testing.T) {
+	input := "((NP (DT the) (NN foo bar)))"
+	if _, err := ParseString(input); err != NoCloseParen {
+		t.Errorf("expected %v; got %v", NoCloseParen, err)
+	}
+	parser := NewParser(strings.NewReader(input))
+	parser.MultiWordPreTerminals = true
+	tree, err := parser.Next()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s := tree.String(); s != input {
+		t.Errorf("expected %q; got %q", input, s)
+	}
+	topo := tree.Topology
+	// NN is node 3 with leaves 4 and 5.
+	if !topo.PreTerminalMulti(3) || topo.PreTerminal(3) {
+		t.Errorf("expected a multi-word pre-terminal at %q", tree.StringUnder(3))
+	}
+	if !topo.PreTerminalMulti(1) || !topo.PreTerminal(1) {
+		t.Errorf("expected a pre-terminal at %q", tree.StringUnder(1))
+	}
+	if topo.PreTerminalMulti(0) || topo.PreTerminalMulti(4) {
+		t.Errorf("expected no pre-terminal at NP or leaves")
+	}
+
+	parser = NewParser(strings.NewReader("((NP 3 (DT 1 the) (NN 2 foo bar)))"))
+	parser.MultiWordPreTerminals = true
+	parser.LengthMode = LENGTH_VALIDATE
+	if _, err := parser.Next(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParserConsumed(t *testing.T) {
+	first := "  ((S (NP a) (VP b)))"
+	second := "\n((S c))\n"
+	parser := NewParser(strings.NewReader(first + second))
+	if n := parser.Consumed(); n != 0 {
+		t.Errorf("expected 0; got %d", n)
+	}
+	if _, err := parser.Next(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := parser.Consumed(); n != int64(len(first)) {
+		t.Errorf("expected %d; got %d", len(first), n)
+	}
+	if _, err := parser.Next(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := parser.Consumed(); n != int64(len(first+second))-1 {
+		t.Errorf("expected %d; got %d", len(first+second)-1, n)
+	}
+	if _, err := parser.Next(); err != io.EOF {
+		t.Errorf("expected %v; got %v", io.EOF, err)
+	}
+	if n := parser.Consumed(); n != int64(len(first+second)) {
+		t.Errorf("expected %d; got %d", len(first+second), n)
+	}
+}
+
+func TestParserFoldCase(t *testing.T) {
+	parser := NewParser(strings.NewReader("((NP The)) ((S (NP I) (VP (VBD SAW) (NP It))))"))
+	parser.FoldCase = true
+	expected := [][]string{{"np", "the"}, {"s", "np", "i", "vp", "vbd", "saw", "np", "it"}}
+	for _, labels := range expected {
+		tree, err := parser.Next()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(tree.Label, labels) {
+			t.Errorf("expected %v; got %v", labels, tree.Label)
+		}
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		input := strings.NewReader(benchmarkCases)
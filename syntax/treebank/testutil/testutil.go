@@ -0,0 +1,44 @@
+// Package testutil provides helpers for testing code that transforms
+// treebank trees.
+package testutil
+
+import (
+	"bufio"
+	"github.com/kho/nlp_basic/syntax/treebank"
+	"os"
+)
+
+// T is the subset of *testing.T used by the helpers.
+type T interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AssertTreeFile parses the trees in the golden file at goldenPath and
+// compares them with got tree by tree using ParseTree.Equal. The first
+// mismatch (or a difference in the number of trees, or a failure to
+// read the file) is reported through t with both trees serialized. It
+// returns whether got matches the file.
+func AssertTreeFile(t T, got []*treebank.ParseTree, goldenPath string) bool {
+	f, err := os.Open(goldenPath)
+	if err != nil {
+		t.Errorf("cannot open golden file: %v", err)
+		return false
+	}
+	defer f.Close()
+	gold, err := treebank.ParseAll(bufio.NewReader(f))
+	if err != nil {
+		t.Errorf("cannot parse golden file %s after %d trees: %v", goldenPath, len(gold), err)
+		return false
+	}
+	for i := 0; i < len(gold) && i < len(got); i++ {
+		if !got[i].Equal(gold[i]) {
+			t.Errorf("tree %d differs from %s:\nexpected %s\ngot      %s", i, goldenPath, gold[i], got[i])
+			return false
+		}
+	}
+	if len(gold) != len(got) {
+		t.Errorf("expected %d trees from %s; got %d", len(gold), goldenPath, len(got))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package testutil
+
+import (
+	"fmt"
+	"github.com/kho/nlp_basic/syntax/treebank"
+	"testing"
+)
+
+// recorder is a T that records the errors.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func fromStrings(ss ...string) []*treebank.ParseTree {
+	trees := make([]*treebank.ParseTree, len(ss))
+	for i, s := range ss {
+		trees[i] = treebank.FromString(s)
+	}
+	return trees
+}
+
+var assertTreeFileCases = []struct {
+	got  []*treebank.ParseTree
+	path string
+	ok   bool
+}{
+	{fromStrings("((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "(())", "((S (NP (PRP it)) (VP (VBZ works))))"), "testdata/golden.mrg", true},
+	{fromStrings("((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "(())", "((S (NP (PRP it)) (VP (VBD worked))))"), "testdata/golden.mrg", false},
+	{fromStrings("((S (NP (DT the) (NN cat)) (VP (VBD sat))))", "(())"), "testdata/golden.mrg", false},
+	{nil, "testdata/missing.mrg", false},
+}
+
+func TestAssertTreeFile(t *testing.T) {
+	for _, c := range assertTreeFileCases {
+		r := &recorder{}
+		if ok := AssertTreeFile(r, c.got, c.path); ok != c.ok {
+			t.Errorf("expected %v; got %v with errors %q", c.ok, ok, r.errors)
+		}
+		if c.ok && len(r.errors) != 0 || !c.ok && len(r.errors) != 1 {
+			t.Errorf("unexpected errors %q", r.errors)
+		}
+	}
+	r := &recorder{}
+	AssertTreeFile(r, assertTreeFileCases[1].got, "testdata/golden.mrg")
+	expected := "tree 2 differs from testdata/golden.mrg:\nexpected ((S (NP (PRP it)) (VP (VBZ works))))\ngot      ((S (NP (PRP it)) (VP (VBD worked))))"
+	if len(r.errors) != 1 || r.errors[0] != expected {
+		t.Errorf("expected %q; got %q", expected, r.errors)
+	}
+}
@@ -1,5 +1,10 @@
 package treebank
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Topology stores the tree structure. A topology consists of N nodes,
 // with id from 0 to (N-1) forming a forest. The tree under Root is
 // the tree that is represented by the Topology. Or when Root is
@@ -9,11 +14,14 @@ type Topology struct {
 	Root     NodeId
 	Children [][]NodeId
 	// UpLink is the link to the parent of a node. This is
-	// optional. When it is not present, it is set to nil. However, when
-	// it is present, it is not updated when the Topology is modified
-	// (e.g. via AddNode(), AppendChild(), Disconnect()). On the other
-	// hand, all Topology methods do not read from this. It is thus
-	// recommended to FillUpLink() only after the Topology is finalized.
+	// optional. When it is not present, it is set to nil. Topology
+	// methods that change the parent links (e.g. AppendChild(),
+	// Disconnect()) clear it, and AddNode() leaves it one element
+	// short. Topology methods only read from this as a shortcut when
+	// it has one element per node (e.g. AreSiblings()), so it must be
+	// up-to-date whenever it is present. It is thus recommended to
+	// FillUpLink() only after the Topology is finalized, and never to
+	// modify Children directly while UpLink is present.
 	UpLink []UpLink
 }
 
@@ -49,8 +57,8 @@ func NewEmptyTopology() *Topology {
 }
 
 // Copy creates a deep copy of the given topology. Use this instead of
-// simple assignment for copying. UpLink is *not* copied, following
-// the convention that no Topology method reads it.
+// simple assignment for copying. UpLink is *not* copied; call
+// FillUpLink() on the copy when needed.
 func (t *Topology) Copy() *Topology {
 	var children [][]NodeId
 	if len(t.Children) != 0 {
@@ -109,17 +117,162 @@ func (t *Topology) FillUpLink() {
 	}
 }
 
+// AreSiblings tests whether a and b are distinct nodes with the same
+// parent. UpLink is used when it is present; otherwise the children
+// lists are scanned.
+func (t *Topology) AreSiblings(a, b NodeId) bool {
+	if a == b {
+		return false
+	}
+	if len(t.UpLink) == t.NumNodes() {
+		p := t.UpLink[a].Parent
+		return p != NoNodeId && p == t.UpLink[b].Parent
+	}
+	for _, children := range t.Children {
+		foundA, foundB := false, false
+		for _, child := range children {
+			foundA = foundA || child == a
+			foundB = foundB || child == b
+		}
+		if foundA || foundB {
+			return foundA && foundB
+		}
+	}
+	return false
+}
+
+// Siblings returns the other children of the parent of n in order,
+// or nil when n has no parent. UpLink is used when it is present.
+func (t *Topology) Siblings(n NodeId) []NodeId {
+	p := t.parentLinks()[n]
+	if p == NoNodeId {
+		return nil
+	}
+	siblings := make([]NodeId, 0, len(t.Children[p])-1)
+	for _, c := range t.Children[p] {
+		if c != n {
+			siblings = append(siblings, c)
+		}
+	}
+	return siblings
+}
+
+// NthChild returns the position of n among the children of its
+// parent, or -1 when n has no parent. UpLink is used when it is
+// present.
+func (t *Topology) NthChild(n NodeId) int {
+	if len(t.UpLink) == t.NumNodes() {
+		if t.UpLink[n].Parent == NoNodeId {
+			return -1
+		}
+		return t.UpLink[n].NthChild
+	}
+	p := t.parents()[n]
+	if p == NoNodeId {
+		return -1
+	}
+	for i, c := range t.Children[p] {
+		if c == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// parents computes the parent of every node from Children. A root
+// has NoNodeId as its parent.
+func (t *Topology) parents() []NodeId {
+	parent := make([]NodeId, t.NumNodes())
+	for i := range parent {
+		parent[i] = NoNodeId
+	}
+	for p, children := range t.Children {
+		for _, child := range children {
+			parent[child] = NodeId(p)
+		}
+	}
+	return parent
+}
+
+// parentLinks is like parents but reads from UpLink when it is
+// present.
+func (t *Topology) parentLinks() []NodeId {
+	if len(t.UpLink) != t.NumNodes() {
+		return t.parents()
+	}
+	parent := make([]NodeId, t.NumNodes())
+	for i, link := range t.UpLink {
+		parent[i] = link.Parent
+	}
+	return parent
+}
+
+// Ancestors returns the parent, the grandparent, etc. of n up to the
+// root of its own tree (i.e. Root when n is under Root). The result is
+// empty when n is a root. UpLink is used when it is present.
+func (t *Topology) Ancestors(n NodeId) []NodeId {
+	var ancestors []NodeId
+	parent := t.parentLinks()
+	for p := parent[n]; p != NoNodeId; p = parent[p] {
+		ancestors = append(ancestors, p)
+	}
+	return ancestors
+}
+
+// LCA returns the lowest common ancestor of a and b, which is a (or
+// b) itself when it is an ancestor of the other. It returns NoNodeId
+// when a and b are in different trees. UpLink is used when it is
+// present.
+func (t *Topology) LCA(a, b NodeId) NodeId {
+	parent := t.parentLinks()
+	isAncestorOfA := make([]bool, t.NumNodes())
+	for n := a; n != NoNodeId; n = parent[n] {
+		isAncestorOfA[n] = true
+	}
+	for n := b; n != NoNodeId; n = parent[n] {
+		if isAncestorOfA[n] {
+			return n
+		}
+	}
+	return NoNodeId
+}
+
 // Leaf tests whether the given node is a leaf in its own tree.
 func (t *Topology) Leaf(n NodeId) bool {
 	return len(t.Children[n]) == 0
 }
 
+// Leaves returns the leaves of the tree under Root from left to right.
+// Nodes not reachable from Root are ignored.
+func (t *Topology) Leaves() []NodeId {
+	leaves := []NodeId{}
+	if t.Root != NoNodeId {
+		dfsYield(t, t.Root, &leaves)
+	}
+	return leaves
+}
+
 // PreTerminal tests whether the given node is a pre-terminal in its
 // own tree, i.e. the POS tag node dominating the leaf.
 func (t *Topology) PreTerminal(n NodeId) bool {
 	return len(t.Children[n]) == 1 && t.Leaf(t.Children[n][0])
 }
 
+// PreTerminalMulti is like PreTerminal but also accepts nodes with
+// several children as long as all of them are leaves, e.g. the
+// pre-terminal of a compound token "(NN foo bar)".
+func (t *Topology) PreTerminalMulti(n NodeId) bool {
+	if len(t.Children[n]) == 0 {
+		return false
+	}
+	for _, child := range t.Children[n] {
+		if !t.Leaf(child) {
+			return false
+		}
+	}
+	return true
+}
+
 // AddNode adds a node without a parent (i.e. forming a singleton
 // tree) to the topology and returns the node id of the new node. The
 // newly added node does not have Parent information.
@@ -132,9 +285,81 @@ func (t *Topology) AddNode() NodeId {
 // AppendChild appends child as the rightmost child of parent. The
 // user must ensure that child does not already have a parent because
 // this creates cyclicity. However, child may be Root, in which case
-// the Topology still represents the subtree under child.
+// the Topology still represents the subtree under child. UpLink is
+// cleared.
 func (t *Topology) AppendChild(parent NodeId, child NodeId) {
 	t.Children[parent] = append(t.Children[parent], child)
+	t.UpLink = nil
+}
+
+// SpliceOut removes n from the tree while keeping its subtree: the
+// children of n take its place, in order, among the children of its
+// parent, and n is left as an isolated node. It panics when n is Root
+// or has no parent. UpLink is cleared since the positions of the
+// children change.
+func (t *Topology) SpliceOut(n NodeId) {
+	if n == t.Root {
+		panic("trying to splice out Root")
+	}
+	p := t.parentLinks()[n]
+	if p == NoNodeId {
+		panic("trying to splice out a node without parent")
+	}
+	siblings := t.Children[p]
+	children := make([]NodeId, 0, len(siblings)+len(t.Children[n])-1)
+	for _, c := range siblings {
+		if c == n {
+			children = append(children, t.Children[n]...)
+		} else {
+			children = append(children, c)
+		}
+	}
+	t.Children[p] = children
+	t.Children[n] = nil
+	t.UpLink = nil
+}
+
+// InsertAbove adds a new node in the place of child under its parent
+// (or as Root when child is Root) and makes child its only child. It
+// returns the new node. Only the Topology is changed, so the caller is
+// responsible for extending the annotations of the ParseTree (e.g.
+// Label) to the new node. UpLink is cleared.
+func (t *Topology) InsertAbove(child NodeId) NodeId {
+	p := t.parentLinks()[child]
+	n := t.AddNode()
+	if p != NoNodeId {
+		for i, c := range t.Children[p] {
+			if c == child {
+				t.Children[p][i] = n
+			}
+		}
+	}
+	if child == t.Root {
+		t.Root = n
+	}
+	t.AppendChild(n, child)
+	t.UpLink = nil
+	return n
+}
+
+// SortChildren stably sorts the children of parent in place by
+// less. UpLink is cleared since the positions of the children change.
+func (t *Topology) SortChildren(parent NodeId, less func(a, b NodeId) bool) {
+	children := t.Children[parent]
+	sort.SliceStable(children, func(i, j int) bool { return less(children[i], children[j]) })
+	t.UpLink = nil
+}
+
+// Mirror reverses the children of every node in place, so the tree
+// reads right to left. UpLink is cleared since the positions of the
+// children change.
+func (t *Topology) Mirror() {
+	for _, children := range t.Children {
+		for i, j := 0, len(children)-1; i < j; i, j = i+1, j-1 {
+			children[i], children[j] = children[j], children[i]
+		}
+	}
+	t.UpLink = nil
 }
 
 // Components returns the connect components inside the topology as a
@@ -157,6 +382,191 @@ func (t *Topology) Components() map[NodeId][]NodeId {
 	return m
 }
 
+// ComponentsOrdered is like Components but returns the components as
+// a slice ordered by their minimum node ids, with the nodes inside
+// each component in ascending order.
+func (t *Topology) ComponentsOrdered() [][]NodeId {
+	m := t.Components()
+	components := make([][]NodeId, 0, len(m))
+	for _, nodes := range m {
+		// Components() collects nodes in ascending order already.
+		components = append(components, nodes)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i][0] < components[j][0] })
+	return components
+}
+
+// RerootLargestComponent sets Root to the root of the component with
+// the most nodes when Root is NoNodeId (e.g. after the root is removed
+// by Disconnect) but the topology is not empty. removed should be the
+// slice given to Disconnect (nil when no node was removed): the removed
+// nodes still hold their children, so they and their links are
+// ignored. Only nodes without a parent are considered as roots, so a
+// component that is a cycle is never chosen. Ties are broken in favor
+// of the lowest root id. Nothing is done when Root is set.
+func (t *Topology) RerootLargestComponent(removed []bool) {
+	if t.Root != NoNodeId || t.NumNodes() == 0 {
+		return
+	}
+	isRemoved := func(n NodeId) bool { return removed != nil && removed[n] }
+	numNodes := t.NumNodes()
+	hasParent := make([]bool, numNodes)
+	p := make([]NodeId, numNodes)
+	for i := range p {
+		p[i] = NodeId(i)
+	}
+	for i, children := range t.Children {
+		if isRemoved(NodeId(i)) {
+			continue
+		}
+		for _, c := range children {
+			if !isRemoved(c) {
+				hasParent[c] = true
+				union(NodeId(i), c, p)
+			}
+		}
+	}
+	size := make([]int, numNodes)
+	for i := range p {
+		if !isRemoved(NodeId(i)) {
+			size[find(NodeId(i), p)]++
+		}
+	}
+	best, bestSize := NoNodeId, 0
+	for i := 0; i < numNodes; i++ {
+		node := NodeId(i)
+		if isRemoved(node) || hasParent[node] {
+			continue
+		}
+		if n := size[find(node, p)]; n > bestSize {
+			best, bestSize = node, n
+		}
+	}
+	t.Root = best
+}
+
+// BFS returns the nodes of the tree under Root in level order: every
+// node comes after its parent and the nodes at the same depth are
+// ordered from left to right.
+func (t *Topology) BFS() []NodeId {
+	var order []NodeId
+	for _, level := range t.Levels() {
+		order = append(order, level...)
+	}
+	return order
+}
+
+// Levels returns the nodes of the tree under Root grouped by depth,
+// each level ordered from left to right.
+func (t *Topology) Levels() [][]NodeId {
+	var levels [][]NodeId
+	if t.Root == NoNodeId {
+		return levels
+	}
+	for level := []NodeId{t.Root}; len(level) > 0; {
+		levels = append(levels, level)
+		var next []NodeId
+		for _, n := range level {
+			next = append(next, t.Children[n]...)
+		}
+		level = next
+	}
+	return levels
+}
+
+// Diameter returns the number of edges on the longest path between
+// two leaves of the tree under Root. It returns 0 when the tree is
+// empty or has only one leaf.
+func (t *Topology) Diameter() int {
+	if t.Root == NoNodeId {
+		return 0
+	}
+	order := t.preOrder()
+	// height[n] is the number of edges from n down to its farthest
+	// leaf, computed bottom-up.
+	height := make([]int, t.NumNodes())
+	diameter := 0
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		first, second := -1, -1
+		for _, child := range t.Children[n] {
+			h := height[child] + 1
+			if h > first {
+				first, second = h, first
+			} else if h > second {
+				second = h
+			}
+		}
+		if first > 0 {
+			height[n] = first
+		}
+		if second > 0 && first+second > diameter {
+			diameter = first + second
+		}
+	}
+	return diameter
+}
+
+// Depth returns the number of edges from Root down to n, or -1 when n
+// is not under Root. UpLink is used when it is present.
+func (t *Topology) Depth(n NodeId) int {
+	if t.Root == NoNodeId {
+		return -1
+	}
+	parent := t.parentLinks()
+	depth := 0
+	for ; n != t.Root; n = parent[n] {
+		if n == NoNodeId {
+			return -1
+		}
+		depth++
+	}
+	return depth
+}
+
+// Height returns the number of edges on the longest path from Root
+// down to a leaf. It returns 0 when the tree is empty or is a single
+// node.
+func (t *Topology) Height() int {
+	if t.Root == NoNodeId {
+		return 0
+	}
+	type item struct {
+		node  NodeId
+		depth int
+	}
+	height := 0
+	stack := []item{{t.Root, 0}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.depth > height {
+			height = top.depth
+		}
+		for _, child := range t.Children[top.node] {
+			stack = append(stack, item{child, top.depth + 1})
+		}
+	}
+	return height
+}
+
+// MergeUnderNewRoot adds a new node, appends the root of every
+// component as its child in increasing order of node ids and makes it
+// Root, so that the whole forest becomes one tree. It returns the new
+// node.
+func (t *Topology) MergeUnderNewRoot() NodeId {
+	parent := t.parents()
+	root := t.AddNode()
+	for n, p := range parent {
+		if p == NoNodeId {
+			t.AppendChild(root, NodeId(n))
+		}
+	}
+	t.Root = root
+	t.UpLink = nil
+	return root
+}
+
 func find(n NodeId, p []NodeId) NodeId {
 	r := n
 	for p[r] != r {
@@ -179,26 +589,148 @@ func union(parent NodeId, child NodeId, p []NodeId) {
 // Topsort toplogically sorts the topology in top-down order and
 // returns the mapping from old node ids to new node ids as a
 // slice. Nodes not in the tree under Root are removed and their
-// mapping is set to NoNodeId in the return value. Panics if there is
-// cycle.
+// mapping is set to NoNodeId in the return value. Panics with the
+// error from Validate if the tree under Root is malformed (e.g. has a
+// cycle).
 func (t *Topology) Topsort() []NodeId {
+	if err := t.Validate(); err != nil {
+		panic(err)
+	}
+	oldToNew := remap(t, t.preOrder())
+	return oldToNew
+}
+
+// TopologyError is returned by Validate for a malformed Topology.
+type TopologyError struct {
+	// Node is the offending node.
+	Node NodeId
+	// Reason describes the problem, e.g. "cycle".
+	Reason string
+}
+
+func (e *TopologyError) Error() string {
+	return fmt.Sprintf("invalid Topology at node %d: %s", e.Node, e.Reason)
+}
+
+// Validate checks that the nodes reachable from Root form a tree, i.e.
+// every child id is in range and no node is reached twice (through a
+// cycle or from two parents). It returns a *TopologyError describing
+// the first problem found instead of panicking like Topsort.
+func (t *Topology) Validate() error {
+	if t.Root == NoNodeId {
+		return nil
+	}
+	numNodes := NodeId(t.NumNodes())
+	if t.Root < 0 || t.Root >= numNodes {
+		return &TopologyError{t.Root, "Root out of range"}
+	}
+	visited := make([]bool, numNodes)
+	visited[t.Root] = true
+	stack := []NodeId{t.Root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, c := range t.Children[n] {
+			if c < 0 || c >= numNodes {
+				return &TopologyError{n, fmt.Sprintf("child %d out of range", c)}
+			}
+			if visited[c] {
+				return &TopologyError{c, "cycle or multiple parents"}
+			}
+			visited[c] = true
+			stack = append(stack, c)
+		}
+	}
+	return nil
+}
+
+// preOrder returns the nodes of the tree under Root in pre-order.
+// Panics if there is cycle.
+func (t *Topology) preOrder() []NodeId {
 	traverse := make([]NodeId, 0, t.NumNodes())
 	visited := make([]bool, t.NumNodes())
 	if t.Root != NoNodeId {
 		dfsTraverse(t, t.Root, &traverse, visited)
 	}
-	oldToNew := remap(t, traverse)
-	return oldToNew
+	return traverse
 }
 
-func dfsTraverse(t *Topology, n NodeId, ns *[]NodeId, visited []bool) {
-	if visited[n] {
-		panic("cycle in Topology")
+// PostOrder returns the nodes of the tree under Root in post-order,
+// i.e. every node comes after all its descendants and the children are
+// visited from left to right. Panics if there is cycle.
+func (t *Topology) PostOrder() []NodeId {
+	order := make([]NodeId, 0, t.NumNodes())
+	if t.Root == NoNodeId {
+		return order
+	}
+	// Visit every node before its children from right to left, then
+	// reverse.
+	visited := make([]bool, t.NumNodes())
+	stack := []NodeId{t.Root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[n] {
+			panic("cycle in Topology")
+		}
+		visited[n] = true
+		order = append(order, n)
+		stack = append(stack, t.Children[n]...)
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// SubtreeSizes returns the number of nodes in the subtree under every
+// node (the node itself included), indexed by node id. Nodes not
+// under Root get the sizes within their own trees.
+func (t *Topology) SubtreeSizes() []int {
+	numNodes := t.NumNodes()
+	size := make([]int, numNodes)
+	// Collect every node after its parent, then accumulate backwards.
+	order := make([]NodeId, 0, numNodes)
+	for root, p := range t.parents() {
+		if p != NoNodeId {
+			continue
+		}
+		stack := []NodeId{NodeId(root)}
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			order = append(order, n)
+			stack = append(stack, t.Children[n]...)
+		}
 	}
-	visited[n] = true
-	*ns = append(*ns, n)
-	for _, c := range t.Children[n] {
-		dfsTraverse(t, c, ns, visited)
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		size[n]++
+		for _, c := range t.Children[n] {
+			size[n] += size[c]
+		}
+	}
+	return size
+}
+
+// dfsTraverse appends the nodes under n to ns in pre-order. It uses
+// an explicit stack, so very deep trees do not overflow the goroutine
+// stack.
+func dfsTraverse(t *Topology, n NodeId, ns *[]NodeId, visited []bool) {
+	stack := []NodeId{n}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[n] {
+			panic("cycle in Topology")
+		}
+		visited[n] = true
+		*ns = append(*ns, n)
+		// Push the children in reverse so they are popped left to right.
+		children := t.Children[n]
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
 	}
 }
 
@@ -232,8 +764,9 @@ func remap(t *Topology, newToOld []NodeId) []NodeId {
 }
 
 // Disconnect disconnects nodes marked as true in remove from their
-// parents.
+// parents. UpLink is cleared.
 func (t *Topology) Disconnect(remove []bool) {
+	t.UpLink = nil
 	if t.Root != NoNodeId && remove[t.Root] {
 		t.Root = NoNodeId
 	}
@@ -1,6 +1,7 @@
 package treebank
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -104,6 +105,266 @@ func TestTopologyFillUpLink(t *testing.T) {
 	}
 }
 
+func TestTopologyLeaves(t *testing.T) {
+	tree := FromString("((A (B C) (D (E F) (G H))))")
+	var words []string
+	for _, leaf := range tree.Topology.Leaves() {
+		words = append(words, tree.Label[leaf])
+	}
+	if expected := []string{"C", "F", "H"}; !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %v; got %v", expected, words)
+	}
+
+	// Disconnected nodes are ignored.
+	topo := fromParents(0, []NodeId{NoNodeId, 0, 0, NoNodeId, 3})
+	if expected := []NodeId{1, 2}; !reflect.DeepEqual(topo.Leaves(), expected) {
+		t.Errorf("expected %v; got %v", expected, topo.Leaves())
+	}
+	if leaves := NewEmptyTopology().Leaves(); leaves == nil || len(leaves) != 0 {
+		t.Errorf("expected an empty slice; got %v", leaves)
+	}
+}
+
+func TestTopologySiblings(t *testing.T) {
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 0, 2, NoNodeId})
+	for _, uplink := range []bool{false, true} {
+		if uplink {
+			tree.FillUpLink()
+		}
+		cases := []struct {
+			n        NodeId
+			siblings []NodeId
+			nth      int
+		}{
+			{0, nil, -1},
+			{1, []NodeId{2, 3}, 0},
+			{2, []NodeId{1, 3}, 1},
+			{3, []NodeId{1, 2}, 2},
+			{4, []NodeId{}, 0},
+			{5, nil, -1},
+		}
+		for _, c := range cases {
+			if siblings := tree.Siblings(c.n); !reflect.DeepEqual(siblings, c.siblings) {
+				t.Errorf("expected %v; got %v for %d (UpLink: %v)", c.siblings, siblings, c.n, uplink)
+			}
+			if nth := tree.NthChild(c.n); nth != c.nth {
+				t.Errorf("expected %d; got %d for %d (UpLink: %v)", c.nth, nth, c.n, uplink)
+			}
+		}
+	}
+}
+
+func TestTopologyAncestors(t *testing.T) {
+	//     0
+	//    / \
+	//   1   2
+	//       |
+	//       3
+	//      / \
+	//     4   5   6 (disconnected) - 7
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 2, 3, 3, NoNodeId, 6})
+	for _, uplink := range []bool{false, true} {
+		if uplink {
+			tree.FillUpLink()
+		}
+		cases := []struct {
+			n         NodeId
+			ancestors []NodeId
+		}{
+			{0, nil},
+			{1, []NodeId{0}},
+			{5, []NodeId{3, 2, 0}},
+			{7, []NodeId{6}},
+		}
+		for _, c := range cases {
+			if ancestors := tree.Ancestors(c.n); !reflect.DeepEqual(ancestors, c.ancestors) {
+				t.Errorf("expected %v; got %v for %d (UpLink: %v)", c.ancestors, ancestors, c.n, uplink)
+			}
+		}
+	}
+}
+
+func TestTopologyLCA(t *testing.T) {
+	// Same as in TestTopologyAncestors.
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 2, 3, 3, NoNodeId, 6})
+	for _, uplink := range []bool{false, true} {
+		if uplink {
+			tree.FillUpLink()
+		}
+		cases := []struct {
+			a, b, lca NodeId
+		}{
+			{4, 5, 3},
+			{2, 5, 2},
+			{5, 2, 2},
+			{4, 4, 4},
+			{1, 4, 0},
+			{0, 4, 0},
+			{1, 7, NoNodeId},
+		}
+		for _, c := range cases {
+			if lca := tree.LCA(c.a, c.b); lca != c.lca {
+				t.Errorf("expected %d; got %d for (%d, %d) (UpLink: %v)", c.lca, lca, c.a, c.b, uplink)
+			}
+		}
+	}
+}
+
+func TestTopologyAreSiblings(t *testing.T) {
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 1, 1, 2})
+	siblingsCases := []struct {
+		a, b     NodeId
+		siblings bool
+	}{
+		{1, 2, true}, {2, 1, true}, {3, 4, true},
+		{1, 1, false}, {0, 1, false}, {1, 3, false}, {3, 5, false}, {0, 0, false},
+	}
+	for _, uplink := range []bool{false, true} {
+		if uplink {
+			tree.FillUpLink()
+		}
+		for _, c := range siblingsCases {
+			if s := tree.AreSiblings(c.a, c.b); s != c.siblings {
+				t.Errorf("expected %v; got %v for %d and %d with UpLink %v", c.siblings, s, c.a, c.b, tree.UpLink)
+			}
+		}
+	}
+}
+
+func TestTopologySortChildren(t *testing.T) {
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 0, 0, 2})
+	tree.FillUpLink()
+	// Odd nodes first, then even ones, keeping the relative order.
+	tree.SortChildren(0, func(a, b NodeId) bool { return a%2 == 1 && b%2 == 0 })
+	if expected := []NodeId{1, 3, 2, 4}; !reflect.DeepEqual(tree.Children[0], expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Children[0])
+	}
+	if tree.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", tree.UpLink)
+	}
+	topologySanityCheck(tree, t)
+}
+
+func TestTopologyMirror(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))")
+	orig := tree.Topology.Copy()
+	tree.Topology.FillUpLink()
+	tree.Topology.Mirror()
+	if tree.Topology.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", tree.Topology.UpLink)
+	}
+	topologySanityCheck(tree.Topology, t)
+	if expected := "((S (VP (VBD sat)) (NP (NN cat) (DT the))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+	tree.FillSpan()
+	// The words are now "sat cat the".
+	for i, word := range []string{"sat", "cat", "the"} {
+		for n, label := range tree.Label {
+			if label == word && tree.Span[n] != (Span{i, i + 1}) {
+				t.Errorf("expected %v; got %v for %q", Span{i, i + 1}, tree.Span[n], word)
+			}
+		}
+	}
+	tree.Topology.Mirror()
+	if !tree.Topology.Equal(orig) {
+		t.Errorf("expected %v; got %v after mirroring twice", orig, tree.Topology)
+	}
+}
+
+func TestTopologySpliceOut(t *testing.T) {
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 0, 0, 2, 2})
+	tree.FillUpLink()
+	tree.SpliceOut(2)
+	if expected := []NodeId{1, 4, 5, 3}; !reflect.DeepEqual(tree.Children[0], expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Children[0])
+	}
+	if len(tree.Children[2]) != 0 {
+		t.Errorf("expected no children; got %v", tree.Children[2])
+	}
+	if tree.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", tree.UpLink)
+	}
+	topologySanityCheck(tree, t)
+
+	// Splicing out a leaf just removes it.
+	tree.SpliceOut(5)
+	if expected := []NodeId{1, 4, 3}; !reflect.DeepEqual(tree.Children[0], expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Children[0])
+	}
+
+	for _, n := range []NodeId{0, 2} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic for %d", n)
+				}
+			}()
+			tree.SpliceOut(n)
+		}()
+	}
+}
+
+func TestTopologyInsertAbove(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))")
+	tree.Topology.FillUpLink()
+	vbd := tree.Topology.Children[tree.Topology.Children[tree.Topology.Root][1]][0]
+	tree.Topology.InsertAbove(vbd)
+	tree.Label = append(tree.Label, "V")
+	if tree.Topology.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", tree.Topology.UpLink)
+	}
+	n := tree.Topology.InsertAbove(tree.Topology.Root)
+	tree.Label = append(tree.Label, "ROOT")
+	if tree.Topology.Root != n {
+		t.Errorf("expected Root %d; got %d", n, tree.Topology.Root)
+	}
+	topologySanityCheck(tree.Topology, t)
+	if expected := "((ROOT (S (NP (DT the) (NN cat)) (VP (V (VBD sat))))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+	tree.FillSpan()
+	for i, expected := range []Span{{0, 3}, {0, 3}, {0, 2}, {0, 1}, {0, 1}, {1, 2}, {1, 2}, {2, 3}, {2, 3}, {2, 3}, {2, 3}} {
+		if tree.Span[tree.Topology.preOrder()[i]] != expected {
+			t.Errorf("expected %v; got %v at %d in pre-order", expected, tree.Span[tree.Topology.preOrder()[i]], i)
+		}
+	}
+}
+
+func TestTopologyUpLinkCleared(t *testing.T) {
+	tree := FromString("((S (NP a) (VP b)))")
+	topo := tree.Topology
+	s, np, a, vp := topo.Root, topo.Children[topo.Root][0], NodeId(2), topo.Children[topo.Root][1]
+	topo.FillUpLink()
+	remove := make([]bool, topo.NumNodes())
+	remove[np] = true
+	topo.Disconnect(remove)
+	if topo.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", topo.UpLink)
+	}
+	if topo.AreSiblings(np, vp) {
+		t.Errorf("expected %d and %d not to be siblings", np, vp)
+	}
+	if d := topo.Depth(np); d != -1 {
+		t.Errorf("expected -1; got %d", d)
+	}
+	if expected := []NodeId{np}; !reflect.DeepEqual(topo.Ancestors(a), expected) {
+		t.Errorf("expected %v; got %v", expected, topo.Ancestors(a))
+	}
+	if siblings := topo.Siblings(vp); len(siblings) != 0 {
+		t.Errorf("expected no siblings; got %v", siblings)
+	}
+
+	topo.FillUpLink()
+	topo.AppendChild(s, np)
+	if topo.UpLink != nil {
+		t.Errorf("expected nil UpLink; got %v", topo.UpLink)
+	}
+	if expected := []NodeId{np, s}; !reflect.DeepEqual(topo.Ancestors(a), expected) {
+		t.Errorf("expected %v; got %v", expected, topo.Ancestors(a))
+	}
+}
+
 func TestTopologyComponents(t *testing.T) {
 	if c := NewEmptyTopology().Components(); len(c) != 0 {
 		t.Errorf("expected empty components; got %v\n", c)
@@ -132,6 +393,187 @@ func TestTopologyComponents(t *testing.T) {
 	}
 }
 
+func TestTopologyComponentsOrdered(t *testing.T) {
+	if c := NewEmptyTopology().ComponentsOrdered(); len(c) != 0 {
+		t.Errorf("expected empty components; got %v\n", c)
+	}
+	tree := fromParents(3, []NodeId{4, 3, NoNodeId, NoNodeId, NoNodeId, 3, 1})
+	expected := [][]NodeId{{0, 4}, {1, 3, 5, 6}, {2}}
+	for i := 0; i < 10; i++ {
+		if c := tree.ComponentsOrdered(); !reflect.DeepEqual(c, expected) {
+			t.Fatalf("expected %v; got %v\n", expected, c)
+		}
+	}
+}
+
+func TestTopologyRerootLargestComponent(t *testing.T) {
+	// ((A (B (C D) (E F))))
+	tree := fromParents(0, []NodeId{NoNodeId, 0, 1, 2, 1, 4})
+	remove := []bool{true, false, false, false, false, false}
+	tree.Disconnect(remove)
+	if tree.Root != NoNodeId {
+		t.Fatalf("expected NoNodeId; got %d", tree.Root)
+	}
+	tree.RerootLargestComponent(remove)
+	if tree.Root != 1 {
+		t.Errorf("expected root 1; got %d", tree.Root)
+	}
+
+	// The largest remaining subtree wins over the removed nodes.
+	tree = fromParents(0, []NodeId{NoNodeId, 0, 1, 2, 1, 4})
+	remove = []bool{true, false, false, false, true, false}
+	tree.Disconnect(remove)
+	tree.RerootLargestComponent(remove)
+	if tree.Root != 1 {
+		t.Errorf("expected root 1; got %d", tree.Root)
+	}
+
+	// A cycle has no root to choose.
+	tree = fromParents(NoNodeId, []NodeId{1, 0, NoNodeId})
+	tree.RerootLargestComponent(nil)
+	if tree.Root != 2 {
+		t.Errorf("expected root 2; got %d", tree.Root)
+	}
+
+	// Ties are broken by the lowest root id.
+	tree = fromParents(NoNodeId, []NodeId{NoNodeId, 3, NoNodeId, NoNodeId, 2})
+	tree.RerootLargestComponent(nil)
+	if tree.Root != 2 {
+		t.Errorf("expected root 2; got %d", tree.Root)
+	}
+
+	// Nothing changes when there is a root.
+	tree = fromParents(0, []NodeId{NoNodeId, NoNodeId, 1})
+	tree.RerootLargestComponent(nil)
+	if tree.Root != 0 {
+		t.Errorf("expected root 0; got %d", tree.Root)
+	}
+
+	tree = NewEmptyTopology()
+	tree.RerootLargestComponent(nil)
+	if tree.Root != NoNodeId {
+		t.Errorf("expected NoNodeId; got %d", tree.Root)
+	}
+}
+
+func TestTopologyDiameter(t *testing.T) {
+	diameterCases := []struct {
+		tree     *Topology
+		diameter int
+	}{
+		{NewEmptyTopology(), 0},
+		{NewRootedTopology(), 0},
+		{fromParents(0, []NodeId{NoNodeId, 0, 1}), 0},
+		// Balanced binary tree of depth 2.
+		{fromParents(0, []NodeId{NoNodeId, 0, 0, 1, 1, 2, 2}), 4},
+		// Unbalanced tree.
+		{fromParents(0, []NodeId{NoNodeId, 0, 0, 1, 1, 3, 3, 4, 4, 5}), 5},
+	}
+	for _, c := range diameterCases {
+		if d := c.tree.Diameter(); d != c.diameter {
+			t.Errorf("expected %d; got %d for %v", c.diameter, d, *c.tree)
+		}
+	}
+}
+
+func TestTopologyLevels(t *testing.T) {
+	tree := FromString("((A (B C) (D (E F) (G H))))")
+	var levels [][]string
+	for _, level := range tree.Topology.Levels() {
+		var labels []string
+		for _, n := range level {
+			labels = append(labels, tree.Label[n])
+		}
+		levels = append(levels, labels)
+	}
+	expected := [][]string{{"A"}, {"B", "D"}, {"C", "E", "G"}, {"F", "H"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("expected %v; got %v", expected, levels)
+	}
+	var bfs []string
+	for _, n := range tree.Topology.BFS() {
+		bfs = append(bfs, tree.Label[n])
+	}
+	if expected := []string{"A", "B", "D", "C", "E", "G", "F", "H"}; !reflect.DeepEqual(bfs, expected) {
+		t.Errorf("expected %v; got %v", expected, bfs)
+	}
+
+	// Disconnected nodes are excluded.
+	topo := fromParents(0, []NodeId{NoNodeId, 0, NoNodeId, 2})
+	if expected := []NodeId{0, 1}; !reflect.DeepEqual(topo.BFS(), expected) {
+		t.Errorf("expected %v; got %v", expected, topo.BFS())
+	}
+	if levels := NewEmptyTopology().Levels(); len(levels) != 0 {
+		t.Errorf("expected no levels; got %v", levels)
+	}
+}
+
+func TestTopologyDepthHeight(t *testing.T) {
+	balanced := FromString("((A (B C) (D E)))").Topology
+	if h := balanced.Height(); h != 2 {
+		t.Errorf("expected 2; got %d", h)
+	}
+	for n, expected := range []int{0, 1, 2, 1, 2} {
+		if d := balanced.Depth(NodeId(n)); d != expected {
+			t.Errorf("expected %d; got %d for %d", expected, d, n)
+		}
+	}
+
+	// A right-branching chain 0 -> 2 -> 4 -> ... with a leaf on the left
+	// of each step; the last node is disconnected.
+	const n = 10000
+	parents := make([]NodeId, n+1)
+	parents[0], parents[n] = NoNodeId, NoNodeId
+	for i := 1; i < n; i++ {
+		parents[i] = NodeId((i - 1) / 2 * 2)
+	}
+	chain := fromParents(0, parents)
+	chain.FillUpLink()
+	if h := chain.Height(); h != n/2 {
+		t.Errorf("expected %d; got %d", n/2, h)
+	}
+	if d := chain.Depth(n - 1); d != n/2 {
+		t.Errorf("expected %d; got %d", n/2, d)
+	}
+	if d := chain.Depth(n); d != -1 {
+		t.Errorf("expected -1; got %d", d)
+	}
+	if h := NewEmptyTopology().Height(); h != 0 {
+		t.Errorf("expected 0; got %d", h)
+	}
+
+	// No node is under Root once it is disconnected.
+	chain.Root = NoNodeId
+	if d := chain.Depth(4); d != -1 {
+		t.Errorf("expected -1; got %d", d)
+	}
+}
+
+func TestTopologyMergeUnderNewRoot(t *testing.T) {
+	tree := fromParents(NoNodeId, []NodeId{NoNodeId, NoNodeId})
+	if c := tree.Components(); len(c) != 2 {
+		t.Fatalf("expected 2 components; got %v", c)
+	}
+	root := tree.MergeUnderNewRoot()
+	if root != 2 || tree.Root != root {
+		t.Errorf("expected root 2; got %d and %d", root, tree.Root)
+	}
+	if c := tree.Components(); len(c) != 1 {
+		t.Errorf("expected 1 component; got %v", c)
+	}
+	if expected := []NodeId{0, 1}; !reflect.DeepEqual(tree.Children[root], expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Children[root])
+	}
+	topologySanityCheck(tree, t)
+
+	tree = fromParents(0, []NodeId{NoNodeId, 0, NoNodeId, 2})
+	root = tree.MergeUnderNewRoot()
+	if expected := []NodeId{0, 2}; !reflect.DeepEqual(tree.Children[root], expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Children[root])
+	}
+	topologySanityCheck(tree, t)
+}
+
 func TestTopologyTopsort(t *testing.T) {
 	topsortCases := []*Topology{
 		NewEmptyTopology(), NewRootedTopology(),
@@ -159,6 +601,73 @@ func TestTopologyTopsort(t *testing.T) {
 	}
 }
 
+func TestTopologyTopsortDeep(t *testing.T) {
+	// A chain of 100k nodes where each node is the parent of the one
+	// before it, so that Topsort reverses the ids.
+	const n = 100000
+	parents := make([]NodeId, n)
+	for i := range parents {
+		parents[i] = NodeId(i + 1)
+	}
+	parents[n-1] = NoNodeId
+	tree := fromParents(n-1, parents)
+	oldToNew := tree.Topsort()
+	for i, newNode := range oldToNew {
+		if newNode != NodeId(n-1-i) {
+			t.Fatalf("expected %d; got %d for %d", n-1-i, newNode, i)
+		}
+	}
+	topologySanityCheck(tree, t)
+}
+
+func TestTopologyPostOrder(t *testing.T) {
+	tree := FromString("((A (B C) (D (E F) (G H))))")
+	order := tree.Topology.PostOrder()
+	var labels []string
+	for _, n := range order {
+		labels = append(labels, tree.Label[n])
+	}
+	if expected := []string{"C", "B", "F", "E", "H", "G", "D", "A"}; !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v; got %v", expected, labels)
+	}
+
+	topo := fromParents(3, []NodeId{3, 3, 0, NoNodeId, 1, 1, 0, NoNodeId})
+	order = topo.PostOrder()
+	if len(order) != 7 {
+		t.Errorf("expected 7 nodes; got %v", order)
+	}
+	position := make(map[NodeId]int)
+	for i, n := range order {
+		position[n] = i
+	}
+	for i, n := range order {
+		for _, c := range topo.Children[n] {
+			if position[c] >= i {
+				t.Errorf("expected child %d before %d; got %v", c, n, order)
+			}
+		}
+	}
+	if order := NewEmptyTopology().PostOrder(); len(order) != 0 {
+		t.Errorf("expected no nodes; got %v", order)
+	}
+}
+
+func TestTopologySubtreeSizes(t *testing.T) {
+	tree := FromString("((A (B C) (D (E F))))").Topology
+	sizes := tree.SubtreeSizes()
+	if sizes[tree.Root] != len(tree.preOrder()) {
+		t.Errorf("expected %d; got %d", len(tree.preOrder()), sizes[tree.Root])
+	}
+	if expected := []int{6, 2, 1, 3, 2, 1}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected %v; got %v", expected, sizes)
+	}
+
+	topo := fromParents(0, []NodeId{NoNodeId, 0, NoNodeId, 2, 3})
+	if expected := []int{2, 1, 3, 2, 1}; !reflect.DeepEqual(topo.SubtreeSizes(), expected) {
+		t.Errorf("expected %v; got %v", expected, topo.SubtreeSizes())
+	}
+}
+
 func TestTopologyTopsortCycle(t *testing.T) {
 	tree := NewEmptyTopology()
 	a, b := tree.AddNode(), tree.AddNode()
@@ -176,6 +685,44 @@ func TestTopologyTopsortCycle(t *testing.T) {
 	}()
 }
 
+func TestTopologyValidate(t *testing.T) {
+	for _, tree := range []*Topology{
+		NewEmptyTopology(), NewRootedTopology(),
+		fromParents(0, []NodeId{NoNodeId, 0, 0, 2, NoNodeId, 4}),
+	} {
+		if err := tree.Validate(); err != nil {
+			t.Errorf("unexpected error %v for %v", err, tree)
+		}
+	}
+
+	// 0 -> 1 -> 2 -> 1
+	cycle := fromParents(0, []NodeId{NoNodeId, 0, 1})
+	cycle.AppendChild(2, 1)
+	// 0 -> 1 -> 3, 0 -> 2 -> 3
+	shared := fromParents(0, []NodeId{NoNodeId, 0, 0, 1})
+	shared.AppendChild(2, 3)
+	// 0 -> 5
+	outOfRange := fromParents(0, []NodeId{NoNodeId, 0})
+	outOfRange.AppendChild(0, 5)
+	cases := []struct {
+		tree    *Topology
+		node    NodeId
+		message string
+	}{
+		{cycle, 1, "invalid Topology at node 1: cycle or multiple parents"},
+		{shared, 3, "invalid Topology at node 3: cycle or multiple parents"},
+		{outOfRange, 0, "invalid Topology at node 0: child 5 out of range"},
+		{&Topology{Root: 1, Children: [][]NodeId{nil}}, 1, "invalid Topology at node 1: Root out of range"},
+	}
+	for _, c := range cases {
+		err := c.tree.Validate()
+		e, ok := err.(*TopologyError)
+		if !ok || e.Node != c.node || e.Error() != c.message {
+			t.Errorf("expected %q; got %v", c.message, err)
+		}
+	}
+}
+
 func TestTopologyDisconnect(t *testing.T) {
 	disconnectCases := []struct {
 		input, output *Topology
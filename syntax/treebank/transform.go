@@ -0,0 +1,729 @@
+package treebank
+
+import (
+	"strings"
+)
+
+// clearStructure clears the annotations that depend on the structure
+// of the tree (Span, Head, HeadLeaf, Yield and POS). It is called by
+// transforms that change the topology beyond node removal.
+func (tree *ParseTree) clearStructure() {
+	tree.Span = nil
+	tree.Head = nil
+	tree.HeadLeaf = nil
+	tree.Yield = nil
+	tree.POS = nil
+}
+
+// MergeLeaves merges the leaves at yield positions [start, end) into
+// the first of them, whose label becomes the labels of the merged
+// leaves joined by joiner. The pre-terminals of the other leaves (or
+// the leaves themselves when they are not under a pre-terminal) are
+// removed together with any ancestor left without children, and the
+// tree is then topologically sorted. Label must be valid; the other
+// annotations are cleared.
+func (tree *ParseTree) MergeLeaves(start, end int, joiner string) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	var yield []NodeId
+	if t.Root != NoNodeId {
+		dfsYield(t, t.Root, &yield)
+	}
+	if start < 0 || end > len(yield) || start >= end {
+		panic("invalid leaf range")
+	}
+
+	words := make([]string, 0, end-start)
+	for _, leaf := range yield[start:end] {
+		words = append(words, tree.Label[leaf])
+	}
+	tree.Label[yield[start]] = strings.Join(words, joiner)
+
+	parent := t.parents()
+	remove := make([]bool, t.NumNodes())
+	for _, leaf := range yield[start+1 : end] {
+		node := leaf
+		if p := parent[leaf]; p != NoNodeId && t.PreTerminal(p) {
+			node = p
+		}
+		// Propagate upward while the parent loses all its children.
+		for node != NoNodeId && !remove[node] {
+			remove[node] = true
+			node = parent[node]
+			if node == NoNodeId {
+				break
+			}
+			for _, child := range t.Children[node] {
+				if !remove[child] {
+					node = NoNodeId
+					break
+				}
+			}
+		}
+	}
+	t.Disconnect(remove)
+
+	tree.Id = nil
+	tree.clearStructure()
+	tree.Topsort()
+}
+
+// CollapseEmptyInternals disconnects the nodes marked as true in
+// removed (see Topology.Disconnect) together with the internal nodes
+// left without children by the removal, propagating upwards, and then
+// topologically sorts the tree. Nodes that are leaves to begin with
+// are kept unless marked.
+func (tree *ParseTree) CollapseEmptyInternals(removed []bool) *ParseTree {
+	t := tree.Topology
+	order := t.preOrder()
+	empty := make([]bool, t.NumNodes())
+	copy(empty, removed)
+	// Mark in bottom-up order
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		if empty[node] || t.Leaf(node) {
+			continue
+		}
+		empty[node] = true
+		for _, child := range t.Children[node] {
+			if !empty[child] {
+				empty[node] = false
+				break
+			}
+		}
+	}
+	t.Disconnect(empty)
+	tree.Topsort()
+	return tree
+}
+
+// PunctuationTags are the pre-terminal labels of punctuation used by
+// RaisePunctuation when no tags are given.
+var PunctuationTags = []string{"``", "''", ",", ".", ":"}
+
+// RemovablePunctuationTags are the pre-terminal labels used by
+// RemovePunctuation when no tags are given. Unlike PunctuationTags,
+// they include brackets.
+var RemovablePunctuationTags = []string{"``", "''", ",", ".", ":", "-LRB-", "-RRB-"}
+
+// RaisePunctuation moves every pre-terminal whose label is one of
+// punctTags (PunctuationTags when nil) up towards the root, one level
+// at a time, as long as it is the first or the last child of its
+// parent, so that the word order is preserved. Punctuation at the edge
+// of the sentence thus ends up directly under the root, while
+// punctuation in the middle of a constituent stays. A parent left
+// without children is removed. Label must be valid; the tree is then
+// topologically sorted and the annotations depending on the structure
+// are cleared.
+func (tree *ParseTree) RaisePunctuation(punctTags []string) *ParseTree {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if punctTags == nil {
+		punctTags = PunctuationTags
+	}
+	isPunct := make(map[string]bool, len(punctTags))
+	for _, tag := range punctTags {
+		isPunct[tag] = true
+	}
+	parent := t.parents()
+	for _, node := range t.preOrder() {
+		if !t.PreTerminal(node) || !isPunct[tree.Label[node]] {
+			continue
+		}
+		for p := parent[node]; p != NoNodeId && p != t.Root; p = parent[node] {
+			children := t.Children[p]
+			var after bool
+			switch node {
+			case children[len(children)-1]:
+				t.Children[p] = children[:len(children)-1]
+				after = true
+			case children[0]:
+				t.Children[p] = children[1:]
+			}
+			if len(t.Children[p]) == len(children) {
+				break
+			}
+			g := parent[p]
+			var siblings []NodeId
+			for _, c := range t.Children[g] {
+				if c == p && !after {
+					siblings = append(siblings, node)
+				}
+				if c != p || len(t.Children[p]) != 0 {
+					siblings = append(siblings, c)
+				}
+				if c == p && after {
+					siblings = append(siblings, node)
+				}
+			}
+			t.Children[g] = siblings
+			parent[node] = g
+		}
+	}
+	tree.Id = nil
+	tree.clearStructure()
+	tree.Topsort()
+	return tree
+}
+
+// RemovePunctuation removes every pre-terminal whose label is one of
+// punctTags (RemovablePunctuationTags when nil), together with the
+// ancestors left without children (see CollapseEmptyInternals), and
+// then topologically sorts the tree. Label must be valid; the annotations
+// depending on the structure are cleared.
+func (tree *ParseTree) RemovePunctuation(punctTags []string) *ParseTree {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if punctTags == nil {
+		punctTags = RemovablePunctuationTags
+	}
+	isPunct := make(map[string]bool, len(punctTags))
+	for _, tag := range punctTags {
+		isPunct[tag] = true
+	}
+	remove := make([]bool, t.NumNodes())
+	for n := range remove {
+		remove[n] = t.PreTerminal(NodeId(n)) && isPunct[tree.Label[n]]
+	}
+	tree.Id = nil
+	tree.clearStructure()
+	return tree.CollapseEmptyInternals(remove)
+}
+
+// SiblingPermutations generates variants of the tree by permuting the
+// children of its nodes. At each node with at least two children, up
+// to maxPerNode orders of the children are taken in lexicographic
+// order of the permutation (starting from the original order), and
+// the trees are formed by combining these choices across nodes, up to
+// maxTrees trees in total. The first tree is always a
+// copy of the original. Each tree is an independent copy with only
+// Topology and Label, topologically sorted. Label must be valid.
+func (tree *ParseTree) SiblingPermutations(maxPerNode, maxTrees int) []*ParseTree {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if maxPerNode < 1 || maxTrees < 1 {
+		return nil
+	}
+	var nodes []NodeId
+	var orders [][][]int
+	for _, node := range t.preOrder() {
+		if len(t.Children[node]) < 2 {
+			continue
+		}
+		nodes = append(nodes, node)
+		orders = append(orders, permutations(len(t.Children[node]), maxPerNode))
+	}
+	var trees []*ParseTree
+	choice := make([]int, len(nodes))
+	for len(trees) < maxTrees {
+		variant := &ParseTree{Topology: tree.Topology.Copy(), Label: append([]string(nil), tree.Label...)}
+		for i, node := range nodes {
+			children := variant.Topology.Children[node]
+			for j, k := range orders[i][choice[i]] {
+				children[j] = t.Children[node][k]
+			}
+		}
+		variant.Topsort()
+		trees = append(trees, variant)
+		// Advance to the next combination.
+		i := len(choice) - 1
+		for ; i >= 0; i-- {
+			choice[i]++
+			if choice[i] < len(orders[i]) {
+				break
+			}
+			choice[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return trees
+}
+
+// permutations returns up to max permutations of 0, ..., n-1 in
+// lexicographic order.
+func permutations(n, max int) [][]int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	var perms [][]int
+	for len(perms) < max {
+		perms = append(perms, append([]int(nil), perm...))
+		// Find the next permutation in place.
+		i := n - 2
+		for i >= 0 && perm[i] >= perm[i+1] {
+			i--
+		}
+		if i < 0 {
+			break
+		}
+		j := n - 1
+		for perm[j] <= perm[i] {
+			j--
+		}
+		perm[i], perm[j] = perm[j], perm[i]
+		for l, r := i+1, n-1; l < r; l, r = l+1, r-1 {
+			perm[l], perm[r] = perm[r], perm[l]
+		}
+	}
+	return perms
+}
+
+// MergeUnderNewRoot merges all the components of Topology under a new
+// root with the given label (see Topology.MergeUnderNewRoot) and
+// returns the new root. Label must be valid; the other annotations are
+// cleared.
+func (tree *ParseTree) MergeUnderNewRoot(label string) NodeId {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	root := tree.Topology.MergeUnderNewRoot()
+	tree.Label = append(tree.Label, label)
+	tree.Id = nil
+	tree.Role = nil
+	tree.StableId = nil
+	tree.clearStructure()
+	return root
+}
+
+// Graft copies the tree under the Root of sub into tree as the last
+// child of at; grafting an empty tree does nothing. Label, Head,
+// HeadLeaf and Role are concatenated when they are valid in both
+// trees, and so is Id when both trees share the same Map; otherwise
+// they are cleared. Span, Yield, POS and StableId are cleared since
+// they no longer hold for the whole tree. sub is untouched.
+func (tree *ParseTree) Graft(at NodeId, sub *ParseTree) {
+	if sub.Topology.Root == NoNodeId {
+		return
+	}
+	numNodes, subNumNodes := tree.Topology.NumNodes(), sub.Topology.NumNodes()
+	offset := NodeId(numNodes)
+	for i := 0; i < subNumNodes; i++ {
+		n := tree.Topology.AddNode()
+		for _, c := range sub.Topology.Children[i] {
+			tree.Topology.AppendChild(n, c+offset)
+		}
+	}
+	tree.Topology.AppendChild(at, sub.Topology.Root+offset)
+
+	if len(tree.Label) == numNodes && len(sub.Label) == subNumNodes {
+		tree.Label = append(tree.Label, sub.Label...)
+	} else {
+		tree.Label = nil
+	}
+	if tree.Map == sub.Map && len(tree.Id) == numNodes && len(sub.Id) == subNumNodes {
+		tree.Id = append(tree.Id, sub.Id...)
+	} else {
+		tree.Id = nil
+	}
+	if len(tree.Head) == numNodes && len(sub.Head) == subNumNodes {
+		tree.Head = append(tree.Head, sub.Head...)
+	} else {
+		tree.Head = nil
+	}
+	if len(tree.HeadLeaf) == numNodes && len(sub.HeadLeaf) == subNumNodes {
+		for _, leaf := range sub.HeadLeaf {
+			tree.HeadLeaf = append(tree.HeadLeaf, leaf+offset)
+		}
+	} else {
+		tree.HeadLeaf = nil
+	}
+	if len(tree.Role) == numNodes && len(sub.Role) == subNumNodes {
+		tree.Role = append(tree.Role, sub.Role...)
+	} else {
+		tree.Role = nil
+	}
+	tree.Span = nil
+	tree.Yield = nil
+	tree.POS = nil
+	tree.StableId = nil
+}
+
+// SortChildrenByLabel stably sorts the children of parent by their
+// labels. Label must be valid. Span, Head, Yield and POS are cleared
+// since they depend on the order of children; HeadLeaf stays valid.
+func (tree *ParseTree) SortChildrenByLabel(parent NodeId) {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	tree.Topology.SortChildren(parent, func(a, b NodeId) bool { return tree.Label[a] < tree.Label[b] })
+	tree.Span = nil
+	tree.Head = nil
+	tree.Yield = nil
+	tree.POS = nil
+}
+
+// subtree returns a new tree with the Topology and Label of the tree
+// under n, leaving out the nodes marked in cut (which may be nil)
+// together with everything under them. The tree itself is untouched.
+func (tree *ParseTree) subtree(n NodeId, cut []bool) *ParseTree {
+	sub := &ParseTree{Topology: tree.Topology.Copy(), Label: make([]string, len(tree.Label))}
+	copy(sub.Label, tree.Label)
+	if cut != nil {
+		sub.Topology.Disconnect(cut)
+	}
+	// n itself may have been marked in cut.
+	sub.Topology.Root = n
+	sub.Topsort()
+	return sub
+}
+
+// Subtree returns a new tree made of n and its descendants, with
+// Label, Id, Span, Head, HeadLeaf, Role and StableId copied over when
+// they are valid, and Map shared. Span is shifted so that the subtree
+// starts at 0. Yield and POS are left nil. The tree itself is
+// untouched.
+func (tree *ParseTree) Subtree(n NodeId) *ParseTree {
+	sub := tree.Copy()
+	sub.Yield = nil
+	sub.POS = nil
+	sub.Topology.Root = n
+	sub.Topsort()
+	if len(sub.Span) > 0 {
+		offset := sub.Span[0].Left
+		for i := range sub.Span {
+			sub.Span[i].Left -= offset
+			sub.Span[i].Right -= offset
+		}
+	}
+	return sub
+}
+
+// SubtreeCoveringSpan returns a copy (with Topology and Label only)
+// of the smallest subtree whose span contains [left, right), and
+// whether its span is exactly [left, right). Of a unary chain of
+// nodes with the same span, the topmost one is taken. It returns nil
+// and false when no node covers the span (e.g. the span is empty or
+// beyond the yield). Valid Label and Span slices must present.
+func (tree *ParseTree) SubtreeCoveringSpan(left, right int) (*ParseTree, bool) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if len(tree.Span) != t.NumNodes() {
+		panic("Span and Topology do not match in size")
+	}
+	covers := func(n NodeId) bool {
+		return tree.Span[n].Left <= left && right <= tree.Span[n].Right
+	}
+	if t.Root == NoNodeId || left >= right || !covers(t.Root) {
+		return nil, false
+	}
+	top, node := t.Root, t.Root
+	for {
+		next := NoNodeId
+		for _, child := range t.Children[node] {
+			if covers(child) {
+				next = child
+				break
+			}
+		}
+		if next == NoNodeId {
+			break
+		}
+		if tree.Span[next] != tree.Span[node] {
+			top = next
+		}
+		node = next
+	}
+	return tree.subtree(top, nil), tree.Span[top] == Span{left, right}
+}
+
+// DefaultClauseLabels are the clause labels used by Clauses when none
+// is given.
+var DefaultClauseLabels = []string{"S", "SBAR", "SINV", "SQ"}
+
+// Clauses splits the tree into clauses, each being a new tree rooted
+// at a node whose label (with annotation stripped) is in clauseLabels
+// (DefaultClauseLabels if nil). A clause node immediately under
+// another clause node (e.g. S under SBAR) does not start a clause of
+// its own; any other embedded clause is cut out of the enclosing
+// clause and returned separately. Clauses are returned in pre-order of
+// their roots. Label must be valid.
+func (tree *ParseTree) Clauses(clauseLabels []string) []*ParseTree {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if clauseLabels == nil {
+		clauseLabels = DefaultClauseLabels
+	}
+	isClause := make(map[string]bool)
+	for _, label := range clauseLabels {
+		isClause[label] = true
+	}
+
+	parent := t.parents()
+	start := make([]bool, t.NumNodes())
+	var roots []NodeId
+	for _, n := range t.preOrder() {
+		if !isClause[stripLabelAnnotation(tree.Label[n], "-=")] {
+			continue
+		}
+		if p := parent[n]; p == NoNodeId || !isClause[stripLabelAnnotation(tree.Label[p], "-=")] {
+			start[n] = true
+			roots = append(roots, n)
+		}
+	}
+
+	clauses := make([]*ParseTree, len(roots))
+	cut := make([]bool, t.NumNodes())
+	for i, root := range roots {
+		copy(cut, start)
+		clauses[i] = tree.subtree(root, cut)
+	}
+	return clauses
+}
+
+// SpinalTrees returns, for each leaf in yield order, the spine of
+// nodes headed by that leaf as a chain from its maximal projection
+// down to the leaf itself. These are the simplest elementary trees of
+// a lexicalized grammar. Valid Label and HeadLeaf slices must present.
+func (tree *ParseTree) SpinalTrees() []*ParseTree {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if len(tree.HeadLeaf) != t.NumNodes() {
+		panic("HeadLeaf and Topology do not match in size")
+	}
+	if t.Root == NoNodeId {
+		return nil
+	}
+	// Pre-order visits the leaves in yield order and the nodes of each
+	// spine from top to bottom.
+	order := t.preOrder()
+	spines := make(map[NodeId][]NodeId)
+	var leaves []NodeId
+	for _, n := range order {
+		leaf := tree.HeadLeaf[n]
+		spines[leaf] = append(spines[leaf], n)
+		if t.Leaf(n) {
+			leaves = append(leaves, n)
+		}
+	}
+	ret := make([]*ParseTree, 0, len(leaves))
+	for _, leaf := range leaves {
+		spine := spines[leaf]
+		chain := &ParseTree{Topology: NewEmptyTopology(), Label: make([]string, len(spine))}
+		for i, n := range spine {
+			node := chain.Topology.AddNode()
+			if i > 0 {
+				chain.Topology.AppendChild(node-1, node)
+			}
+			chain.Label[i] = tree.Label[n]
+		}
+		chain.Topology.Root = 0
+		ret = append(ret, chain)
+	}
+	return ret
+}
+
+// Directions of factoring in Binarize.
+const (
+	// The intermediate nodes are the left children, e.g. X -> A B C
+	// becomes X -> (X| A B) C.
+	LEFT_FACTORED = iota
+	// The intermediate nodes are the right children, e.g. X -> A B C
+	// becomes X -> A (X| B C).
+	RIGHT_FACTORED
+)
+
+// Binarize makes the tree at most binary by factoring the children of
+// every node with more than two children into a chain of intermediate
+// nodes labeled by the label of the node followed by marker, which
+// must not be empty. dir is either LEFT_FACTORED or RIGHT_FACTORED.
+// Label must be valid; Span is recomputed when it is valid, and the
+// other annotations are cleared. The tree is then topologically
+// sorted.
+func (tree *ParseTree) Binarize(dir int, marker string) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if marker == "" {
+		panic("empty binarization marker")
+	}
+	hasSpan := len(tree.Span) == t.NumNodes()
+	tree.factor(dir, func(node NodeId, covered []NodeId) string {
+		return tree.Label[node] + marker
+	})
+	tree.Map = nil
+	tree.Id = nil
+	tree.Role = nil
+	tree.clearStructure()
+	tree.Topsort()
+	if hasSpan {
+		tree.FillSpan()
+	}
+}
+
+// factor replaces the children of every node with more than two
+// children by a chain of intermediate nodes in the direction dir. Each
+// intermediate node is labeled by label(node, covered), where covered
+// are the original children of node it spans. Only Topology and Label
+// are updated.
+func (tree *ParseTree) factor(dir int, label func(node NodeId, covered []NodeId) string) {
+	if dir != LEFT_FACTORED && dir != RIGHT_FACTORED {
+		panic("binarization direction must be either LEFT_FACTORED or RIGHT_FACTORED")
+	}
+	t := tree.Topology
+	numNodes := t.NumNodes()
+	for n := 0; n < numNodes; n++ {
+		node := NodeId(n)
+		children := t.Children[node]
+		k := len(children)
+		if k <= 2 {
+			continue
+		}
+		if dir == LEFT_FACTORED {
+			left := children[0]
+			for i := 1; i < k-1; i++ {
+				inter := t.AddNode()
+				tree.Label = append(tree.Label, label(node, children[:i+1]))
+				t.AppendChild(inter, left)
+				t.AppendChild(inter, children[i])
+				left = inter
+			}
+			t.Children[node] = []NodeId{left, children[k-1]}
+		} else {
+			right := children[k-1]
+			for i := k - 2; i > 0; i-- {
+				inter := t.AddNode()
+				tree.Label = append(tree.Label, label(node, children[i:]))
+				t.AppendChild(inter, children[i])
+				t.AppendChild(inter, right)
+				right = inter
+			}
+			t.Children[node] = []NodeId{children[0], right}
+		}
+	}
+}
+
+// Debinarize undoes Binarize by replacing every node whose label ends
+// with marker, which must not be empty, with its children. Label must
+// be valid;
+// Span, HeadLeaf and the other annotations that are not affected by
+// the order of children are kept, while Head, Yield and POS are
+// cleared. The tree is then topologically sorted.
+func (tree *ParseTree) Debinarize(marker string) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if marker == "" {
+		panic("empty binarization marker")
+	}
+	isInter := func(n NodeId) bool { return strings.HasSuffix(tree.Label[n], marker) }
+	if t.Root != NoNodeId && isInter(t.Root) {
+		panic("trying to debinarize an intermediate Root")
+	}
+	var expand func(n NodeId, children []NodeId) []NodeId
+	expand = func(n NodeId, children []NodeId) []NodeId {
+		for _, c := range t.Children[n] {
+			if isInter(c) {
+				children = expand(c, children)
+			} else {
+				children = append(children, c)
+			}
+		}
+		return children
+	}
+	for _, node := range t.preOrder() {
+		if isInter(node) {
+			continue
+		}
+		for _, c := range t.Children[node] {
+			if isInter(c) {
+				t.Children[node] = expand(node, nil)
+				break
+			}
+		}
+	}
+	tree.Head = nil
+	tree.Yield = nil
+	tree.POS = nil
+	tree.Topsort()
+}
+
+// CollapseUnary merges every node that has a single child, which is
+// neither a leaf nor a pre-terminal, with that child, joining their
+// labels with sep, e.g. (S (VP (VB go))) becomes (S+VP (VB go)). Label
+// must be valid; Span, HeadLeaf, Role and StableId are kept while the
+// other annotations are cleared. The tree is then topologically
+// sorted.
+func (tree *ParseTree) CollapseUnary(sep string) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	for _, node := range t.preOrder() {
+		for len(t.Children[node]) == 1 {
+			child := t.Children[node][0]
+			if t.Leaf(child) || t.PreTerminal(child) {
+				break
+			}
+			tree.Label[node] += sep + tree.Label[child]
+			t.Children[node] = t.Children[child]
+			t.Children[child] = nil
+		}
+	}
+	tree.Map = nil
+	tree.Id = nil
+	tree.Head = nil
+	tree.Yield = nil
+	tree.POS = nil
+	tree.Topsort()
+}
+
+// ExpandUnary undoes CollapseUnary by splitting the label of every
+// node other than a leaf at sep into a unary chain. sep must not be
+// empty. Label must be valid; Span is recomputed when it is valid, and
+// the other annotations are cleared. The tree is then topologically
+// sorted.
+func (tree *ParseTree) ExpandUnary(sep string) {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if sep == "" {
+		panic("empty separator")
+	}
+	hasSpan := len(tree.Span) == t.NumNodes()
+	for _, node := range t.preOrder() {
+		if t.Leaf(node) || !strings.Contains(tree.Label[node], sep) {
+			continue
+		}
+		parts := strings.Split(tree.Label[node], sep)
+		tree.Label[node] = parts[0]
+		children := t.Children[node]
+		t.Children[node] = nil
+		bottom := node
+		for _, part := range parts[1:] {
+			n := t.AddNode()
+			tree.Label = append(tree.Label, part)
+			t.AppendChild(bottom, n)
+			bottom = n
+		}
+		t.Children[bottom] = children
+	}
+	tree.Map = nil
+	tree.Id = nil
+	tree.Role = nil
+	tree.StableId = nil
+	tree.clearStructure()
+	tree.Topsort()
+	if hasSpan {
+		tree.FillSpan()
+	}
+}
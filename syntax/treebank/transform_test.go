@@ -0,0 +1,447 @@
+package treebank
+
+import (
+	"github.com/kho/nlp_basic/syntax/heads"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var mergeLeavesCases = []struct {
+	input      string
+	start, end int
+	output     string
+}{
+	{"((S (NP (NNP New) (NNP York)) (VP (V sleeps))))", 0, 2, "((S (NP (NNP New_York)) (VP (V sleeps))))"},
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", 1, 3, "((S (NP (DT the) (NN cat_sat))))"},
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", 2, 3, "((S (NP (DT the) (NN cat)) (VP (V sat))))"},
+}
+
+func TestParseTreeMergeLeaves(t *testing.T) {
+	for _, c := range mergeLeavesCases {
+		tree := FromString(c.input)
+		tree.FillSpan()
+		tree.MergeLeaves(c.start, c.end, "_")
+		expected := FromString(c.output)
+		if !equiv(tree, expected) {
+			t.Errorf("expected %q; got %q after merging [%d, %d) of %q", expected, tree, c.start, c.end, c.input)
+		}
+	}
+
+	tree := FromString("((S (NP (NNP New) (NNP York)) (VP (V sleeps))))")
+	tree.MergeLeaves(0, 2, " ")
+	if label := tree.Label[3]; label != "New York" {
+		t.Errorf("expected %q; got %q", "New York", label)
+	}
+}
+
+func TestParseTreeSortChildrenByLabel(t *testing.T) {
+	tree := FromString("((S (VP b) (NP a) (ADVP c) (NP d)))")
+	tree.FillSpan()
+	tree.SortChildrenByLabel(tree.Topology.Root)
+	if s, expected := tree.String(), "((S (ADVP c) (NP a) (NP d) (VP b)))"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+	if tree.Span != nil {
+		t.Errorf("expected nil Span; got %v", tree.Span)
+	}
+}
+
+func TestParseTreeClauses(t *testing.T) {
+	tree := FromString("((S (NP I) (VP (V think) (SBAR (IN that) (S-1 (NP it) (VP rains))))))")
+	clauses := tree.Clauses(nil)
+	expected := []string{
+		"((S (NP I) (VP (V think))))",
+		"((SBAR (IN that) (S-1 (NP it) (VP rains))))",
+	}
+	if len(clauses) != len(expected) {
+		t.Fatalf("expected %d clauses; got %d", len(expected), len(clauses))
+	}
+	for i, c := range clauses {
+		if s := c.String(); s != expected[i] {
+			t.Errorf("expected %q; got %q", expected[i], s)
+		}
+	}
+	if s := tree.String(); s != "((S (NP I) (VP (V think) (SBAR (IN that) (S-1 (NP it) (VP rains))))))" {
+		t.Errorf("expected the tree to be untouched; got %q", s)
+	}
+
+	if clauses := tree.Clauses([]string{"VP"}); len(clauses) != 2 {
+		t.Errorf("expected 2 VP clauses; got %v", clauses)
+	}
+	if clauses := tree.Clauses([]string{"X"}); len(clauses) != 0 {
+		t.Errorf("expected no clauses; got %v", clauses)
+	}
+}
+
+func TestParseTreeSpinalTrees(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat) (ADVP (RB here)))))")
+	tree.FillHead(&heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	})
+	tree.FillHeadLeaf()
+	expected := []string{
+		"((DT the))",
+		"((NP (NN cat)))",
+		"((S (VP (VBD sat))))",
+		"((ADVP (RB here)))",
+	}
+	spines := tree.SpinalTrees()
+	if len(spines) != 4 {
+		t.Fatalf("expected 4 spines; got %d", len(spines))
+	}
+	for i, spine := range spines {
+		topologySanityCheck(spine.Topology, t)
+		if s := spine.String(); s != expected[i] {
+			t.Errorf("expected %q; got %q", expected[i], s)
+		}
+	}
+}
+
+var collapseEmptyInternalsCases = []struct {
+	input  string
+	remove []int
+	output string
+}{
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", nil, "((S (NP (DT the) (NN cat)) (VP (V sat))))"},
+	// Pruning the only child of VP removes VP as well.
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", []int{7}, "((S (NP (DT the) (NN cat))))"},
+	// Pruning both words under NP removes DT, NN and NP.
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", []int{3, 5}, "((S (VP (V sat))))"},
+	{"((S (VP (V sat))))", []int{2}, "(())"},
+	// DT goes but NP keeps NN.
+	{"((S (NP (DT the) (NN cat)) (VP (V sat))))", []int{3}, "((S (NP (NN cat)) (VP (V sat))))"},
+}
+
+func TestParseTreeCollapseEmptyInternals(t *testing.T) {
+	for _, c := range collapseEmptyInternalsCases {
+		tree := FromString(c.input)
+		remove := make([]bool, tree.Topology.NumNodes())
+		for _, n := range c.remove {
+			remove[n] = true
+		}
+		tree.CollapseEmptyInternals(remove)
+		topologySanityCheck(tree.Topology, t)
+		if expected := FromString(c.output); !equiv(tree, expected) {
+			t.Errorf("expected %q; got %q after removing %v from %q", expected, tree, c.remove, c.input)
+		}
+	}
+}
+
+var raisePunctuationCases = []struct {
+	input, output string
+}{
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat) (. .))))", "((S (NP (DT the) (NN cat)) (VP (VBD sat)) (. .)))"},
+	{"((S (NP a) (VP (V b) (NP (N c) (. .)))))", "((S (NP a) (VP (V b) (NP (N c))) (. .)))"},
+	{"((S (NP (`` ``) (NN a)) (VP b)))", "((S (`` ``) (NP (NN a)) (VP b)))"},
+	{"((S (NP a) (VP b) (X (. .))))", "((S (NP a) (VP b) (. .)))"},
+	// Not at an edge.
+	{"((S (NP (NP a) (, ,) (NP b)) (VP c)))", "((S (NP (NP a) (, ,) (NP b)) (VP c)))"},
+	{"((S (NP a) (VP b) (. .)))", "((S (NP a) (VP b) (. .)))"},
+	{"((. .))", "((. .))"},
+	// Brackets stay in their PRN.
+	{"((S (NP a) (PRN (-LRB- -LRB-) (NP b) (-RRB- -RRB-))))", "((S (NP a) (PRN (-LRB- -LRB-) (NP b) (-RRB- -RRB-))))"},
+}
+
+func TestParseTreeRaisePunctuation(t *testing.T) {
+	for _, c := range raisePunctuationCases {
+		tree := FromString(c.input)
+		tree.RaisePunctuation(nil)
+		topologySanityCheck(tree.Topology, t)
+		if expected := FromString(c.output); !equiv(tree, expected) {
+			t.Errorf("expected %q; got %q for %q", expected, tree, c.input)
+		}
+	}
+
+	tree := FromString("((S (NP a) (VP (V b) (PU !))))")
+	tree.RaisePunctuation([]string{"PU"})
+	if s, expected := tree.String(), "((S (NP a) (VP (V b)) (PU !)))"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+func TestParseTreeSiblingPermutations(t *testing.T) {
+	tree := FromString("((S (NP a) (VP b)))")
+	trees := tree.SiblingPermutations(10, 1000)
+	expected := []string{"((S (NP a) (VP b)))", "((S (VP b) (NP a)))"}
+	if len(trees) != len(expected) {
+		t.Fatalf("expected %d trees; got %d", len(expected), len(trees))
+	}
+	for i, tr := range trees {
+		if !equiv(tr, FromString(expected[i])) {
+			t.Errorf("expected %q; got %q", expected[i], tr)
+		}
+	}
+	// The results are independent of each other and of the original.
+	trees[0].Label[1] = "X"
+	if tree.Label[1] != "NP" || trees[1].Label[3] != "NP" {
+		t.Errorf("expected independent trees")
+	}
+
+	// 3! orders at S capped to 4, times 2 orders at VP.
+	tree = FromString("((S (A a) (B b) (VP (V v) (NP n))))")
+	if n := len(tree.SiblingPermutations(4, 1000)); n != 8 {
+		t.Errorf("expected 8 trees; got %d", n)
+	}
+	if trees := tree.SiblingPermutations(1, 1000); len(trees) != 1 || !equiv(trees[0], tree) {
+		t.Errorf("expected only the original tree; got %v", trees)
+	}
+	if n := len(tree.SiblingPermutations(4, 5)); n != 5 {
+		t.Errorf("expected 5 trees; got %d", n)
+	}
+	if trees := tree.SiblingPermutations(4, 0); trees != nil {
+		t.Errorf("expected no trees; got %v", trees)
+	}
+}
+
+func TestPermutations(t *testing.T) {
+	expected := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	if perms := permutations(3, 100); !reflect.DeepEqual(perms, expected) {
+		t.Errorf("expected %v; got %v", expected, perms)
+	}
+	if perms := permutations(3, 2); !reflect.DeepEqual(perms, expected[:2]) {
+		t.Errorf("expected %v; got %v", expected[:2], perms)
+	}
+}
+
+var subtreeCoveringSpanCases = []struct {
+	left, right int
+	output      string
+	exact       bool
+}{
+	{0, 2, "((NP (DT the) (NN cat)))", true},
+	{1, 3, "((S (NP (DT the) (NN cat)) (VP (VBD sat) (PP (IN on) (NP (DT the) (NN mat))))))", false},
+	{3, 5, "((PP (IN on) (NP (DT the) (NN mat))))", false},
+	{2, 6, "((VP (VBD sat) (PP (IN on) (NP (DT the) (NN mat)))))", true},
+	{1, 2, "((NN cat))", true},
+	{0, 6, "((S (NP (DT the) (NN cat)) (VP (VBD sat) (PP (IN on) (NP (DT the) (NN mat))))))", true},
+}
+
+func TestParseTreeSubtree(t *testing.T) {
+	input := "((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP (PRP it)))))"
+	tree := FromString(input)
+	tree.FillSpan()
+	tree.FillHead(&heads.TableHeadFinder{Fallback: heads.HEAD_INITIAL})
+	tree.FillHeadLeaf()
+	vp := tree.Topology.Children[tree.Topology.Root][1]
+	sub := tree.Subtree(vp)
+	topologySanityCheck(sub.Topology, t)
+	if expected := "((VP (VBD saw) (NP (PRP it))))"; sub.String() != expected {
+		t.Errorf("expected %q; got %q", expected, sub)
+	}
+	if expected := []Span{{0, 2}, {0, 1}, {0, 1}, {1, 2}, {1, 2}, {1, 2}}; !reflect.DeepEqual(sub.Span, expected) {
+		t.Errorf("expected %v; got %v", expected, sub.Span)
+	}
+	if expected := []NodeId{2, 2, 2, 5, 5, 5}; !reflect.DeepEqual(sub.HeadLeaf, expected) {
+		t.Errorf("expected %v; got %v", expected, sub.HeadLeaf)
+	}
+	if tree.String() != input || tree.Span[vp] != (Span{2, 4}) {
+		t.Errorf("expected the tree to be untouched; got %q with span %v", tree, tree.Span[vp])
+	}
+}
+
+func TestParseTreeGraft(t *testing.T) {
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_INITIAL}
+	tree := FromString("((S (NP (PRP I)) (VP (VBD saw))))")
+	tree.FillSpan()
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	sub := FromString("((NP (DT the) (NN cat)))")
+	sub.FillHead(finder)
+	sub.FillHeadLeaf()
+	vp := tree.Topology.Children[tree.Topology.Root][1]
+	tree.Graft(vp, sub)
+	topologySanityCheck(tree.Topology, t)
+	if expected := "((S (NP (PRP I)) (VP (VBD saw) (NP (DT the) (NN cat)))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+	if tree.Span != nil {
+		t.Errorf("expected nil Span; got %v", tree.Span)
+	}
+	headLeaf := tree.HeadLeaf
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	if !reflect.DeepEqual(headLeaf, tree.HeadLeaf) {
+		t.Errorf("expected %v; got %v", tree.HeadLeaf, headLeaf)
+	}
+	if sub.String() != "((NP (DT the) (NN cat)))" {
+		t.Errorf("expected sub to be untouched; got %q", sub)
+	}
+
+	// Grafting an empty tree does nothing.
+	tree.Graft(vp, FromString("(())"))
+	if expected := "((S (NP (PRP I)) (VP (VBD saw) (NP (DT the) (NN cat)))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+}
+
+func TestParseTreeSubtreeCoveringSpan(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat) (PP (IN on) (NP (DT the) (NN mat))))))")
+	tree.FillSpan()
+	for _, c := range subtreeCoveringSpanCases {
+		sub, exact := tree.SubtreeCoveringSpan(c.left, c.right)
+		if exact != c.exact {
+			t.Errorf("expected %v; got %v for [%d, %d)", c.exact, exact, c.left, c.right)
+		}
+		if expected := FromString(c.output); sub == nil || !equiv(sub, expected) {
+			t.Errorf("expected %q; got %q for [%d, %d)", expected, sub, c.left, c.right)
+		}
+	}
+	for _, sp := range []Span{{2, 2}, {5, 7}, {-1, 1}} {
+		if sub, exact := tree.SubtreeCoveringSpan(sp.Left, sp.Right); sub != nil || exact {
+			t.Errorf("expected nil and false; got %q and %v for %v", sub, exact, sp)
+		}
+	}
+}
+
+func TestParseTreeMergeUnderNewRoot(t *testing.T) {
+	tree := &ParseTree{
+		Topology: fromParents(NoNodeId, []NodeId{NoNodeId, 0, NoNodeId, 2}),
+		Label:    []string{"NP", "a", "VP", "b"},
+	}
+	if root := tree.MergeUnderNewRoot("FRAG"); root != 4 {
+		t.Errorf("expected root 4; got %d", root)
+	}
+	tree.Topsort()
+	if s, expected := tree.String(), "((FRAG (NP a) (VP b)))"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+var removePunctuationCases = []struct {
+	input, output string
+}{
+	{"((S (NP (NP (NNP John)) (, ,) (NP (PRP$ his) (NN friend)) (, ,)) (VP (VBD left)) (. .)))",
+		"((S (NP (NP (NNP John)) (NP (PRP$ his) (NN friend))) (VP (VBD left))))"},
+	{"((S (`` ``) (NP (PRP I)) (VP (VBD won) (PRN (-LRB- -LRB-) (. !) (-RRB- -RRB-))) ('' '')))",
+		"((S (NP (PRP I)) (VP (VBD won))))"},
+	{"((. .))", "(())"},
+}
+
+func TestParseTreeRemovePunctuation(t *testing.T) {
+	for _, c := range removePunctuationCases {
+		tree := FromString(c.input)
+		tree.RemovePunctuation(nil)
+		topologySanityCheck(tree.Topology, t)
+		if expected := FromString(c.output); !equiv(tree, expected) {
+			t.Errorf("expected %q; got %q for %q", expected, tree, c.input)
+		}
+	}
+	tree := FromString("((S (NP (PRP I)) (VP (VBD won)) (PU !)))")
+	tree.RemovePunctuation([]string{"PU"})
+	if s, expected := tree.String(), "((S (NP (PRP I)) (VP (VBD won))))"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+var binarizeCases = []struct {
+	input, left, right string
+}{
+	{"(())", "(())", "(())"},
+	{"((S (A a) (B b)))", "((S (A a) (B b)))", "((S (A a) (B b)))"},
+	{
+		"((S (A a) (B b) (C c) (D d)))",
+		"((S (S| (S| (A a) (B b)) (C c)) (D d)))",
+		"((S (A a) (S| (B b) (S| (C c) (D d)))))",
+	},
+	{
+		"((S (NP (DT the) (JJ big) (NN cat)) (VP (VBD sat))))",
+		"((S (NP (NP| (DT the) (JJ big)) (NN cat)) (VP (VBD sat))))",
+		"((S (NP (DT the) (NP| (JJ big) (NN cat))) (VP (VBD sat))))",
+	},
+	{
+		"((S (A|B a) (B b) (C c)))",
+		"((S (S| (A|B a) (B b)) (C c)))",
+		"((S (A|B a) (S| (B b) (C c))))",
+	},
+}
+
+func TestParseTreeBinarize(t *testing.T) {
+	for _, c := range binarizeCases {
+		for _, dir := range []struct {
+			dir    int
+			output string
+		}{{LEFT_FACTORED, c.left}, {RIGHT_FACTORED, c.right}} {
+			tree := FromString(c.input)
+			tree.FillSpan()
+			tree.Binarize(dir.dir, "|")
+			topologySanityCheck(tree.Topology, t)
+			if tree.String() != dir.output {
+				t.Errorf("expected %q; got %q for %q", dir.output, tree, c.input)
+			}
+			span := tree.Span
+			tree.FillSpan()
+			if !reflect.DeepEqual(span, tree.Span) {
+				t.Errorf("expected %v; got %v for %q", tree.Span, span, c.input)
+			}
+			tree.Debinarize("|")
+			topologySanityCheck(tree.Topology, t)
+			if expected := FromString(c.input).String(); tree.String() != expected {
+				t.Errorf("expected %q; got %q after debinarizing", expected, tree)
+			}
+			span = tree.Span
+			tree.FillSpan()
+			if !reflect.DeepEqual(span, tree.Span) {
+				t.Errorf("expected %v; got %v after debinarizing %q", tree.Span, span, c.input)
+			}
+		}
+	}
+
+	input := "((S (NNP New York City) (VP (VBD slept))))"
+	parser := NewParser(strings.NewReader(input))
+	parser.MultiWordPreTerminals = true
+	tree, err := parser.Next()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	tree.Binarize(LEFT_FACTORED, "|")
+	if s, expected := tree.String(), "((S (NNP (NNP| New York) City) (VP (VBD slept))))"; s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+	tree.Debinarize("|")
+	if s := tree.String(); s != input {
+		t.Errorf("expected %q; got %q after debinarizing", input, s)
+	}
+}
+
+var collapseUnaryCases = []struct {
+	input, output string
+}{
+	{"(())", "(())"},
+	{"((S (VP (VB go))))", "((S+VP (VB go)))"},
+	{"((ROOT (S (VP (VB go)))))", "((ROOT+S+VP (VB go)))"},
+	{
+		"((S (NP (NP (DT the) (NN cat))) (VP (VBD sat) (PP (IN on) (NP (NN it))))))",
+		"((S (NP+NP (DT the) (NN cat)) (VP (VBD sat) (PP (IN on) (NP (NN it))))))",
+	},
+}
+
+func TestParseTreeCollapseUnary(t *testing.T) {
+	for _, c := range collapseUnaryCases {
+		tree := FromString(c.input)
+		tree.FillSpan()
+		tree.CollapseUnary("+")
+		topologySanityCheck(tree.Topology, t)
+		if tree.String() != c.output {
+			t.Errorf("expected %q; got %q", c.output, tree)
+		}
+		span := tree.Span
+		tree.FillSpan()
+		if !reflect.DeepEqual(span, tree.Span) {
+			t.Errorf("expected %v; got %v for %q", tree.Span, span, c.input)
+		}
+		tree.ExpandUnary("+")
+		topologySanityCheck(tree.Topology, t)
+		if expected := FromString(c.input).String(); tree.String() != expected {
+			t.Errorf("expected %q; got %q after expanding", expected, tree)
+		}
+		span = tree.Span
+		tree.FillSpan()
+		if !reflect.DeepEqual(span, tree.Span) {
+			t.Errorf("expected %v; got %v after expanding %q", tree.Span, span, c.input)
+		}
+	}
+}
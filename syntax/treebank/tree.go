@@ -2,8 +2,13 @@ package treebank
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"github.com/kho/nlp_basic/bimap"
 	"github.com/kho/nlp_basic/syntax/heads"
+	"hash/fnv"
+	"strconv"
+	"strings"
 )
 
 // ParseTree is a tree topology with rich annotations of nodes stored
@@ -17,16 +22,35 @@ type ParseTree struct {
 	// The following may be nil or not up-to-date.
 	Map      *bimap.Map // Map between label and Id
 	Label    []string   // Node label as string
-	Id       []int      // Node label as int
+	Id       []int32    // Node label as int
 	Span     []Span     // A [left, right) input span of the node
 	Head     []int      // The position of the head child of a give node; leaf's head child is some undefined value.
 	HeadLeaf []NodeId   // The head leaf of a give node; leaf's head is itself
 	Yield    []NodeId   // Leaf nodes
 	POS      []NodeId   // Pre-terminal nodes
+	Role     []string   // Semantic role of the node; "" when it has none
+	StableId []int      // Identity of the node that survives renumbering; see AssignStableIds
 }
 
 type Span struct{ Left, Right int }
 
+// Errors returned when a required annotation is not available.
+var (
+	NoLabel    = errors.New("Label and Topology do not match in size")
+	NoSpan     = errors.New("Span and Topology do not match in size")
+	NoHead     = errors.New("Head and Topology do not match in size")
+	NoHeadLeaf = errors.New("HeadLeaf and Topology do not match in size")
+	NoId       = errors.New("Id and Topology do not match in size")
+	NoMap      = errors.New("no label mapping is specified")
+	NoPOS      = errors.New("POS and the yield do not match")
+)
+
+// Errors returned when the spans given to a method are not usable.
+var (
+	BadSpan          = errors.New("span is empty or out of the yield")
+	OverlappingSpans = errors.New("spans overlap")
+)
+
 // Group of constants that decides what to fill in ParseTree.Fill().
 const (
 	// When Label is available, always fills Id; otherwise use Id to
@@ -90,20 +114,30 @@ func (tree *ParseTree) RemapByLabel(m *bimap.Map) {
 }
 
 // RemapById remaps Label by Id using the given mapping. If m is nil,
-// the mapping that is already stored is used.
+// the mapping that is already stored is used. Panics if Id is not
+// valid or there is no mapping; see TryRemapById.
 func (tree *ParseTree) RemapById(m *bimap.Map) {
+	if err := tree.TryRemapById(m); err != nil {
+		panic(err)
+	}
+}
+
+// TryRemapById is like RemapById but returns NoId or NoMap instead of
+// panicking, in which case the tree is left untouched.
+func (tree *ParseTree) TryRemapById(m *bimap.Map) error {
 	if len(tree.Id) != tree.Topology.NumNodes() {
-		panic("Id and Topology do not match in size")
+		return NoId
 	}
 	if m == nil {
 		if tree.Map == nil {
-			panic("RemapById without specifying a map")
+			return NoMap
 		}
 	} else {
 		tree.Map = m
 	}
 	tree.Label = tree.Label[:0]
 	tree.Map.AppendByInt(tree.Id, &tree.Label)
+	return nil
 }
 
 // FillSpan fills the Span slice.
@@ -134,6 +168,85 @@ func dfsFillSpan(tree *ParseTree, node NodeId, left int) int {
 	return right
 }
 
+// NodesStartingAt returns the nodes under Root whose span starts at
+// pos in pre-order. A valid Span slice must present.
+func (tree *ParseTree) NodesStartingAt(pos int) []NodeId {
+	return tree.nodesAtBoundary(func(sp Span) bool { return sp.Left == pos })
+}
+
+// NodesEndingAt returns the nodes under Root whose span ends at pos
+// (i.e. Span.Right == pos) in pre-order. A valid Span slice must
+// present.
+func (tree *ParseTree) NodesEndingAt(pos int) []NodeId {
+	return tree.nodesAtBoundary(func(sp Span) bool { return sp.Right == pos })
+}
+
+func (tree *ParseTree) nodesAtBoundary(match func(Span) bool) []NodeId {
+	if len(tree.Span) != tree.Topology.NumNodes() {
+		panic("Span and Topology do not match in size")
+	}
+	var nodes []NodeId
+	for _, node := range tree.Topology.preOrder() {
+		if match(tree.Span[node]) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// AnnotateSpans fills the Role slice by assigning roles[span] to
+// every node whose span is a key of roles, and "" to the others. A
+// valid Span slice must present.
+func (tree *ParseTree) AnnotateSpans(roles map[Span]string) {
+	numNodes := tree.Topology.NumNodes()
+	if len(tree.Span) != numNodes {
+		panic("Span and Topology do not match in size")
+	}
+	if cap(tree.Role) >= numNodes {
+		tree.Role = tree.Role[:numNodes]
+	} else {
+		tree.Role = make([]string, numNodes)
+	}
+	for i, sp := range tree.Span {
+		tree.Role[i] = roles[sp]
+	}
+}
+
+// EntityBIO tags each word in the yield as B-TYPE, I-TYPE or O
+// according to the entity spans, where entities maps a span to its
+// type. It returns BadSpan when an entity span is empty or goes
+// beyond the yield and OverlappingSpans when two entities overlap. A
+// valid Span slice must present.
+func (tree *ParseTree) EntityBIO(entities map[Span]string) ([]string, error) {
+	if len(tree.Span) != tree.Topology.NumNodes() {
+		return nil, NoSpan
+	}
+	numWords := 0
+	if tree.Topology.Root != NoNodeId {
+		numWords = tree.Span[tree.Topology.Root].Right
+	}
+	tags := make([]string, numWords)
+	for i := range tags {
+		tags[i] = "O"
+	}
+	for sp, typ := range entities {
+		if sp.Left < 0 || sp.Right > numWords || sp.Left >= sp.Right {
+			return nil, BadSpan
+		}
+		for i := sp.Left; i < sp.Right; i++ {
+			if tags[i] != "O" {
+				return nil, OverlappingSpans
+			}
+			if i == sp.Left {
+				tags[i] = "B-" + typ
+			} else {
+				tags[i] = "I-" + typ
+			}
+		}
+	}
+	return tags, nil
+}
+
 // FillHead fills the Head slice with the given head finder. A valid
 // Label slice must present.
 func (tree *ParseTree) FillHead(finder heads.HeadFinder) {
@@ -195,6 +308,42 @@ func (tree *ParseTree) FillHeadLeaf() {
 	tree.HeadLeaf = hl
 }
 
+// HeadSpine returns the chain of nodes from Root down to the head
+// leaf of the whole tree, following the head child at each step. A
+// valid Head slice must present.
+func (tree *ParseTree) HeadSpine() []NodeId {
+	if len(tree.Head) != tree.Topology.NumNodes() {
+		panic("Head and Topology do not match in size")
+	}
+	var spine []NodeId
+	node := tree.Topology.Root
+	for node != NoNodeId {
+		spine = append(spine, node)
+		if tree.Topology.Leaf(node) {
+			break
+		}
+		node = tree.Topology.Children[node][tree.Head[node]]
+	}
+	return spine
+}
+
+// HeadWord returns the label of the head leaf of node n, which is the
+// node itself for a leaf. It returns false when the tree is empty or
+// n is not a valid node. Valid Label and HeadLeaf slices must present.
+func (tree *ParseTree) HeadWord(n NodeId) (string, bool) {
+	numNodes := tree.Topology.NumNodes()
+	if len(tree.HeadLeaf) != numNodes {
+		panic("HeadLeaf and Topology do not match in size")
+	}
+	if len(tree.Label) != numNodes {
+		panic("Label and Topology do not match in size")
+	}
+	if tree.Topology.Root == NoNodeId || n < 0 || int(n) >= numNodes {
+		return "", false
+	}
+	return tree.Label[tree.HeadLeaf[n]], true
+}
+
 func (tree *ParseTree) FillYield() {
 	buf := tree.Yield[:0]
 	if tree.Topology.Root != NoNodeId {
@@ -213,6 +362,106 @@ func dfsYield(t *Topology, n NodeId, buf *[]NodeId) {
 	}
 }
 
+// Words returns the labels of the leaves under Root in order, or an
+// empty slice when the tree is empty. Label must be valid.
+func (tree *ParseTree) Words() []string {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	leaves := tree.Topology.Leaves()
+	words := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		words[i] = tree.Label[leaf]
+	}
+	return words
+}
+
+// Tags returns the labels of the pre-terminals of the words (see
+// Words), aligned with the words. A word not under a pre-terminal
+// (e.g. one with siblings, or a leaf Root) gets "". POS is used when
+// it has one node per word; otherwise the pre-terminals are found
+// from Topology. Label must be valid.
+func (tree *ParseTree) Tags() []string {
+	t := tree.Topology
+	if len(tree.Label) != t.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	leaves := t.Leaves()
+	tags := make([]string, len(leaves))
+	if len(tree.POS) == len(leaves) {
+		for i, pos := range tree.POS {
+			tags[i] = tree.Label[pos]
+		}
+		return tags
+	}
+	parent := t.parents()
+	for i, leaf := range leaves {
+		if p := parent[leaf]; p != NoNodeId && t.PreTerminal(p) {
+			tags[i] = tree.Label[p]
+		}
+	}
+	return tags
+}
+
+// Sentence returns the words (see Words) joined by single spaces.
+// Label must be valid.
+func (tree *ParseTree) Sentence() string {
+	return strings.Join(tree.Words(), " ")
+}
+
+// YieldWordsNoTraces returns the labels of the leaves under Root in
+// order, skipping the leaves that are traces or empty elements. A leaf
+// is skipped when isTrace holds for its own label or the label of its
+// pre-terminal; the labels of phrasal nodes are not tested. When
+// isTrace is nil, labels starting with '*' and "-NONE-" are taken as
+// traces. Label must be valid.
+func (tree *ParseTree) YieldWordsNoTraces(isTrace func(string) bool) []string {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	if isTrace == nil {
+		isTrace = isDefaultTrace
+	}
+	var words []string
+	if tree.Topology.Root != NoNodeId {
+		dfsYieldWords(tree, tree.Topology.Root, NoNodeId, isTrace, &words)
+	}
+	return words
+}
+
+func isDefaultTrace(label string) bool {
+	return label == "-NONE-" || strings.HasPrefix(label, "*")
+}
+
+func dfsYieldWords(tree *ParseTree, n, parent NodeId, isTrace func(string) bool, buf *[]string) {
+	t := tree.Topology
+	if t.Leaf(n) {
+		if isTrace(tree.Label[n]) || parent != NoNodeId && t.PreTerminalMulti(parent) && isTrace(tree.Label[parent]) {
+			return
+		}
+		*buf = append(*buf, tree.Label[n])
+	} else {
+		for _, child := range t.Children[n] {
+			dfsYieldWords(tree, child, n, isTrace, buf)
+		}
+	}
+}
+
+// LeafIndexMap computes the position of every leaf under Root in the
+// yield from the current Topology, returning both the mapping from
+// leaves to positions and its inverse (i.e. the yield).
+func (tree *ParseTree) LeafIndexMap() (map[NodeId]int, []NodeId) {
+	var yield []NodeId
+	if tree.Topology.Root != NoNodeId {
+		dfsYield(tree.Topology, tree.Topology.Root, &yield)
+	}
+	index := make(map[NodeId]int, len(yield))
+	for i, leaf := range yield {
+		index[leaf] = i
+	}
+	return index, yield
+}
+
 func (tree *ParseTree) FillPOS() {
 	buf := tree.POS[:0]
 	if tree.Topology.Root != NoNodeId {
@@ -231,10 +480,73 @@ func dfsPOS(t *Topology, n NodeId, buf *[]NodeId) {
 	}
 }
 
+// TaggedToken is a word with its POS tag.
+type TaggedToken struct {
+	Word, Tag string
+}
+
+// TaggedTokens returns the words under pre-terminals together with
+// their POS tags in the order of the yield. Label must be valid.
+func (tree *ParseTree) TaggedTokens() []TaggedToken {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	var pos []NodeId
+	if tree.Topology.Root != NoNodeId {
+		dfsPOS(tree.Topology, tree.Topology.Root, &pos)
+	}
+	tokens := make([]TaggedToken, len(pos))
+	for i, node := range pos {
+		tokens[i] = TaggedToken{tree.Label[tree.Topology.Children[node][0]], tree.Label[node]}
+	}
+	return tokens
+}
+
+// ProductionCounts counts the productions at the internal nodes of
+// the tree (lexical ones included), where each production string
+// "parent -> child1 child2 ..." is interned by m. The result maps ids
+// in m to counts, so sharing m across trees gives a consistent
+// feature space. Label must be valid.
+func (tree *ParseTree) ProductionCounts(m *bimap.Map) map[int]int {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	counts := make(map[int]int)
+	children := make([]string, 0, 16)
+	for _, node := range tree.Topology.preOrder() {
+		if tree.Topology.Leaf(node) {
+			continue
+		}
+		children = children[:0]
+		for _, child := range tree.Topology.Children[node] {
+			children = append(children, tree.Label[child])
+		}
+		counts[int(m.Add(productionString(tree.Label[node], children)))]++
+	}
+	return counts
+}
+
+// StringOptions controls the output of StringWith.
+type StringOptions struct {
+	// Separator goes between a label and its children and between
+	// siblings. The default ("") is a single space.
+	Separator string
+	// TrailingNewline appends a newline to the output.
+	TrailingNewline bool
+	// QuoteSpecial writes labels that are empty or contain white
+	// spaces, parentheses or double quotes as Go string literals.
+	QuoteSpecial bool
+}
+
 // String writes out the tree in standard Treebank format. Label must
 // be valid; or if Map and Id are available, Label will be constructed
 // and used.
 func (tree *ParseTree) String() string {
+	return tree.StringWith(StringOptions{})
+}
+
+// StringWith is like String but with custom formatting options.
+func (tree *ParseTree) StringWith(opts StringOptions) string {
 	if len(tree.Label) != tree.Topology.NumNodes() {
 		if tree.Map != nil && len(tree.Id) == tree.Topology.NumNodes() {
 			tree.RemapById(nil)
@@ -242,14 +554,20 @@ func (tree *ParseTree) String() string {
 			panic("Cannot get valid Label")
 		}
 	}
+	if opts.Separator == "" {
+		opts.Separator = " "
+	}
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	buf.WriteByte('(')
 	if tree.Topology.Root == NoNodeId {
 		buf.WriteString("()")
 	} else {
-		dfsString(tree, tree.Topology.Root, buf)
+		dfsString(tree, tree.Topology.Root, &opts, buf)
 	}
 	buf.WriteByte(')')
+	if opts.TrailingNewline {
+		buf.WriteByte('\n')
+	}
 	return buf.String()
 }
 
@@ -257,27 +575,161 @@ func (tree *ParseTree) String() string {
 func (tree *ParseTree) StringUnder(node NodeId) string {
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	if node != NoNodeId {
-		dfsString(tree, node, buf)
+		dfsString(tree, node, &StringOptions{Separator: " "}, buf)
 	}
 	return buf.String()
 }
 
 // dfsString traverses a non-empty tree starting at node and writes
 // the string representation to buf.
-func dfsString(tree *ParseTree, node NodeId, buf *bytes.Buffer) {
+func dfsString(tree *ParseTree, node NodeId, opts *StringOptions, buf *bytes.Buffer) {
 	if tree.Topology.Leaf(node) {
-		buf.WriteString(tree.Label[node])
+		writeLabel(tree.Label[node], opts, buf)
 	} else {
 		buf.WriteByte('(')
-		buf.WriteString(tree.Label[node])
+		writeLabel(tree.Label[node], opts, buf)
 		for _, child := range tree.Topology.Children[node] {
-			buf.WriteByte(' ')
-			dfsString(tree, child, buf)
+			buf.WriteString(opts.Separator)
+			dfsString(tree, child, opts, buf)
 		}
 		buf.WriteByte(')')
 	}
 }
 
+func writeLabel(label string, opts *StringOptions, buf *bytes.Buffer) {
+	if opts.QuoteSpecial && (label == "" || strings.ContainsAny(label, " \t\n()\"")) {
+		buf.WriteString(strconv.Quote(label))
+	} else {
+		buf.WriteString(label)
+	}
+}
+
+// BracketedYield renders the tree on one line as its words with the
+// constituents bracketed, e.g. "[S [NP the cat] [VP sleeps]]".
+// Pre-terminals are omitted. Label must be valid.
+func (tree *ParseTree) BracketedYield() string {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 1024))
+	if tree.Topology.Root != NoNodeId {
+		dfsBracketedYield(tree, tree.Topology.Root, buf)
+	}
+	return buf.String()
+}
+
+func dfsBracketedYield(tree *ParseTree, node NodeId, buf *bytes.Buffer) {
+	t := tree.Topology
+	switch {
+	case t.Leaf(node):
+		buf.WriteString(tree.Label[node])
+	case t.PreTerminal(node):
+		dfsBracketedYield(tree, t.Children[node][0], buf)
+	default:
+		buf.WriteByte('[')
+		buf.WriteString(tree.Label[node])
+		for _, child := range t.Children[node] {
+			buf.WriteByte(' ')
+			dfsBracketedYield(tree, child, buf)
+		}
+		buf.WriteByte(']')
+	}
+}
+
+// Equal tests if two trees have identical topologies and labels. The
+// other annotations are ignored. Label must be valid in both trees.
+func (tree *ParseTree) Equal(other *ParseTree) bool {
+	if !tree.Topology.Equal(other.Topology) || len(tree.Label) != len(other.Label) {
+		return false
+	}
+	for i, label := range tree.Label {
+		if label != other.Label[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a deep copy of the tree: the Topology (without UpLink,
+// see Topology.Copy) and every non-nil annotation slice are copied,
+// while Map is shared.
+func (tree *ParseTree) Copy() *ParseTree {
+	c := &ParseTree{Topology: tree.Topology.Copy(), Map: tree.Map}
+	if tree.Label != nil {
+		c.Label = append(make([]string, 0, len(tree.Label)), tree.Label...)
+	}
+	if tree.Id != nil {
+		c.Id = append(make([]int32, 0, len(tree.Id)), tree.Id...)
+	}
+	if tree.Span != nil {
+		c.Span = append(make([]Span, 0, len(tree.Span)), tree.Span...)
+	}
+	if tree.Head != nil {
+		c.Head = append(make([]int, 0, len(tree.Head)), tree.Head...)
+	}
+	if tree.HeadLeaf != nil {
+		c.HeadLeaf = append(make([]NodeId, 0, len(tree.HeadLeaf)), tree.HeadLeaf...)
+	}
+	if tree.Yield != nil {
+		c.Yield = append(make([]NodeId, 0, len(tree.Yield)), tree.Yield...)
+	}
+	if tree.POS != nil {
+		c.POS = append(make([]NodeId, 0, len(tree.POS)), tree.POS...)
+	}
+	if tree.Role != nil {
+		c.Role = append(make([]string, 0, len(tree.Role)), tree.Role...)
+	}
+	if tree.StableId != nil {
+		c.StableId = append(make([]int, 0, len(tree.StableId)), tree.StableId...)
+	}
+	return c
+}
+
+// EqualWithClassifier is like Equal but tolerates corpora that
+// disagree on whether a pre-terminal carries a POS tag or a phrasal
+// label: two labels of a pre-terminal only have to be identical when
+// isPOS classifies them the same way. All the other labels are
+// compared strictly.
+func EqualWithClassifier(a, b *ParseTree, isPOS func(string) bool) bool {
+	if !a.Topology.Equal(b.Topology) || len(a.Label) != len(b.Label) {
+		return false
+	}
+	for i, la := range a.Label {
+		lb := b.Label[i]
+		if la == lb {
+			continue
+		}
+		if a.Topology.PreTerminal(NodeId(i)) && isPOS(la) != isPOS(lb) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Hash returns a hash value of the topology and labels of the tree,
+// so that Equal trees always have the same hash value.
+func (tree *ParseTree) Hash() uint64 {
+	h := fnv.New64a()
+	var buf [4]byte
+	writeInt := func(i int) {
+		binary.LittleEndian.PutUint32(buf[:], uint32(i))
+		h.Write(buf[:])
+	}
+	writeInt(int(tree.Topology.Root))
+	for i, children := range tree.Topology.Children {
+		writeInt(len(children))
+		for _, child := range children {
+			writeInt(int(child))
+		}
+		if i < len(tree.Label) {
+			writeInt(len(tree.Label[i]))
+			h.Write([]byte(tree.Label[i]))
+		}
+	}
+	return h.Sum64()
+}
+
 // TopSort topologically sorts the tree and re-organizes the optional
 // properties into a top-down order. Invalid properties are cleared to
 // nil. The mapping from old NodeId to new ones is returned.
@@ -288,10 +740,12 @@ func (tree *ParseTree) Topsort() []NodeId {
 
 	var (
 		newLabel    []string
-		newId       []int
+		newId       []int32
 		newSpan     []Span
 		newHead     []int
 		newHeadLeaf []NodeId
+		newRole     []string
+		newStableId []int
 	)
 
 	mapLabel := len(tree.Label) == oldNumNodes
@@ -299,12 +753,14 @@ func (tree *ParseTree) Topsort() []NodeId {
 	mapSpan := len(tree.Span) == oldNumNodes
 	mapHead := len(tree.Head) == oldNumNodes
 	mapHeadLeaf := len(tree.HeadLeaf) == oldNumNodes
+	mapRole := len(tree.Role) == oldNumNodes
+	mapStableId := len(tree.StableId) == oldNumNodes
 
 	if mapLabel {
 		newLabel = make([]string, numNodes)
 	}
 	if mapId {
-		newId = make([]int, numNodes)
+		newId = make([]int32, numNodes)
 	}
 	if mapSpan {
 		newSpan = make([]Span, numNodes)
@@ -315,6 +771,12 @@ func (tree *ParseTree) Topsort() []NodeId {
 	if mapHeadLeaf {
 		newHeadLeaf = make([]NodeId, numNodes)
 	}
+	if mapRole {
+		newRole = make([]string, numNodes)
+	}
+	if mapStableId {
+		newStableId = make([]int, numNodes)
+	}
 
 	for o, n := range oldToNew {
 		if n == NoNodeId {
@@ -335,6 +797,12 @@ func (tree *ParseTree) Topsort() []NodeId {
 		if mapHeadLeaf {
 			newHeadLeaf[n] = oldToNew[tree.HeadLeaf[o]]
 		}
+		if mapRole {
+			newRole[n] = tree.Role[o]
+		}
+		if mapStableId {
+			newStableId[n] = tree.StableId[o]
+		}
 	}
 
 	tree.Id = newId
@@ -342,36 +810,78 @@ func (tree *ParseTree) Topsort() []NodeId {
 	tree.Span = newSpan
 	tree.Head = newHead
 	tree.HeadLeaf = newHeadLeaf
+	tree.Role = newRole
+	tree.StableId = newStableId
 
 	return oldToNew
 }
 
+// AssignStableIds sets the StableId of every node to its current
+// NodeId. Since Topsort carries StableId through renumbering, this
+// allows tracking the identity of nodes across transforms.
+func (tree *ParseTree) AssignStableIds() {
+	numNodes := tree.Topology.NumNodes()
+	if cap(tree.StableId) >= numNodes {
+		tree.StableId = tree.StableId[:numNodes]
+	} else {
+		tree.StableId = make([]int, numNodes)
+	}
+	for i := range tree.StableId {
+		tree.StableId[i] = i
+	}
+}
+
 // StripAnnotation strips off rich treebank annotation (e.g. NP-1,
 // NP-SUBJ, etc) and returns the tree itself.
 func (tree *ParseTree) StripAnnotation() *ParseTree {
+	return tree.StripAnnotationSep("-=")
+}
+
+// StripAnnotationSep is like StripAnnotation but cuts a label at the
+// first occurrence of any character in seps (e.g. "#" for NP#SBJ).
+func (tree *ParseTree) StripAnnotationSep(seps string) *ParseTree {
 	for i, label := range tree.Label {
 		node := NodeId(i)
 		if tree.Topology.Leaf(node) {
 			// Only strip if starting with * (i.e. *pro*, *T*, *PRO*, etc.)
 			if len(label) > 0 && label[0] == '*' {
-				tree.Label[i] = stripLabelAnnotation(label)
+				tree.Label[i] = stripLabelAnnotation(label, seps)
 			}
 		} else {
 			// Do not strip if this is -NONE-
 			if len(label) > 0 && label[0] != '-' {
-				tree.Label[i] = stripLabelAnnotation(label)
+				tree.Label[i] = stripLabelAnnotation(label, seps)
 			}
 		}
 	}
 	return tree
 }
 
-func stripLabelAnnotation(label string) string {
-	i := 0
-	for i < len(label) && label[i] != '-' && label[i] != '=' {
-		i++
+func stripLabelAnnotation(label string, seps string) string {
+	if i := strings.IndexAny(label, seps); i >= 0 {
+		return label[:i]
+	}
+	return label
+}
+
+// MapLeaves replaces the label of every leaf with f applied to it,
+// leaving the other labels untouched. Id is cleared since it no longer
+// matches Label. Label must be valid.
+func (tree *ParseTree) MapLeaves(f func(string) string) {
+	if len(tree.Label) != tree.Topology.NumNodes() {
+		panic("Label and Topology do not match in size")
 	}
-	return label[:i]
+	for i, label := range tree.Label {
+		if tree.Topology.Leaf(NodeId(i)) {
+			tree.Label[i] = f(label)
+		}
+	}
+	tree.Id = nil
+}
+
+// Lowercase lowercases the words of the tree (see MapLeaves).
+func (tree *ParseTree) Lowercase() {
+	tree.MapLeaves(strings.ToLower)
 }
 
 // RemoveNone removes -NONE- and its unary ancestors.
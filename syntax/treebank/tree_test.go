@@ -4,7 +4,9 @@ import (
 	"github.com/kho/nlp_basic/bimap"
 	"github.com/kho/nlp_basic/syntax/heads"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode"
 )
 
 var labelIdRemapCases = []string{"((S (NP this) (VP (V is) (NP (DT a) (NN test)))))", "(())"}
@@ -39,7 +41,32 @@ func TestParseTreeRemapById(t *testing.T) {
 	}
 }
 
-func checkLabelId(label []string, id []int, m *bimap.Map, t *testing.T) {
+func TestParseTreeTryRemapById(t *testing.T) {
+	m := bimap.New()
+	tree := FromString("((S (NP this) (VP is)))")
+	tree.RemapByLabel(m)
+	label := tree.Label
+	tree.Id = tree.Id[:2]
+	if err := tree.TryRemapById(m); err != NoId {
+		t.Errorf("expected %q; got %q", NoId, err)
+	}
+	if !reflect.DeepEqual(tree.Label, label) {
+		t.Errorf("expected Label to be untouched; got %v", tree.Label)
+	}
+
+	tree = FromString("((S (NP this) (VP is)))")
+	tree.RemapByLabel(m)
+	tree.Map = nil
+	if err := tree.TryRemapById(nil); err != NoMap {
+		t.Errorf("expected %q; got %q", NoMap, err)
+	}
+	if err := tree.TryRemapById(m); err != nil {
+		t.Errorf("expected nil; got %q", err)
+	}
+	checkLabelId(tree.Label, tree.Id, m, t)
+}
+
+func checkLabelId(label []string, id []int32, m *bimap.Map, t *testing.T) {
 	if len(label) != len(id) {
 		t.Errorf("Label has %d labels; Id has %d ids", len(label), len(id))
 	}
@@ -81,6 +108,139 @@ func TestParseTreeFillSpan(t *testing.T) {
 	}
 }
 
+func TestParseTreeNodesAtBoundary(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (V sat) (ADVP (RB down)))))")
+	tree.FillSpan()
+	// S:0 NP:1 DT:2 the:3 NN:4 cat:5 VP:6 V:7 sat:8 ADVP:9 RB:10 down:11
+	if nodes := tree.NodesEndingAt(2); !reflect.DeepEqual(nodes, []NodeId{1, 4, 5}) {
+		t.Errorf("expected [1 4 5]; got %v", nodes)
+	}
+	if nodes := tree.NodesStartingAt(2); !reflect.DeepEqual(nodes, []NodeId{6, 7, 8}) {
+		t.Errorf("expected [6 7 8]; got %v", nodes)
+	}
+	if nodes := tree.NodesStartingAt(0); !reflect.DeepEqual(nodes, []NodeId{0, 1, 2, 3}) {
+		t.Errorf("expected [0 1 2 3]; got %v", nodes)
+	}
+	if nodes := tree.NodesEndingAt(0); len(nodes) != 0 {
+		t.Errorf("expected no nodes; got %v", nodes)
+	}
+}
+
+func TestParseTreeAnnotateSpans(t *testing.T) {
+	tree := FromString("((S (VP (V saw) (NP it)) (NP (DT the) (NN cat))))")
+	tree.FillSpan()
+	tree.AnnotateSpans(map[Span]string{{2, 4}: "ARG0", {0, 1}: "V", {5, 6}: "ARG1"})
+	// Move the subject NP in front of the VP so that Topsort renumbers
+	// the nodes.
+	children := tree.Topology.Children[0]
+	children[0], children[1] = children[1], children[0]
+	tree.Topsort()
+	// S:0 NP:1 DT:2 the:3 NN:4 cat:5 VP:6 V:7 saw:8 NP:9 it:10
+	expected := []string{"", "ARG0", "", "", "", "", "", "V", "V", "", ""}
+	if !reflect.DeepEqual(tree.Role, expected) {
+		t.Errorf("expected %q; got %q", expected, tree.Role)
+	}
+}
+
+var entityBIOCases = []struct {
+	entities map[Span]string
+	tags     []string
+	err      error
+}{
+	{nil, []string{"O", "O", "O", "O"}, nil},
+	{map[Span]string{{0, 2}: "PER"}, []string{"B-PER", "I-PER", "O", "O"}, nil},
+	{map[Span]string{{0, 2}: "PER", {3, 4}: "LOC"}, []string{"B-PER", "I-PER", "O", "B-LOC"}, nil},
+	{map[Span]string{{0, 2}: "PER", {1, 3}: "ORG"}, nil, OverlappingSpans},
+	{map[Span]string{{3, 5}: "LOC"}, nil, BadSpan},
+	{map[Span]string{{2, 2}: "LOC"}, nil, BadSpan},
+}
+
+func TestParseTreeEntityBIO(t *testing.T) {
+	tree := FromString("((S (NP (NNP John) (NNP Smith)) (VP (VBD visited) (NP (NNP Paris)))))")
+	if _, err := tree.EntityBIO(nil); err != NoSpan {
+		t.Errorf("expected %v; got %v", NoSpan, err)
+	}
+	tree.FillSpan()
+	for _, c := range entityBIOCases {
+		tags, err := tree.EntityBIO(c.entities)
+		if err != c.err {
+			t.Errorf("expected %v; got %v for %v", c.err, err, c.entities)
+		}
+		if !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("expected %v; got %v for %v", c.tags, tags, c.entities)
+		}
+	}
+}
+
+func TestParseTreeAssignStableIds(t *testing.T) {
+	original := FromString("((S (VP (V saw) (NP it)) (NP (DT the) (NN cat))))")
+	tree := FromString(original.String())
+	tree.AssignStableIds()
+	if expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(tree.StableId, expected) {
+		t.Fatalf("expected %v; got %v", expected, tree.StableId)
+	}
+	// Move the subject NP in front of the VP and drop the object NP so
+	// that Topsort renumbers the nodes.
+	children := tree.Topology.Children[0]
+	children[0], children[1] = children[1], children[0]
+	tree.Topology.Children[1] = tree.Topology.Children[1][:1]
+	tree.Topsort()
+	// S:0 NP:1 DT:2 the:3 NN:4 cat:5 VP:6 V:7 saw:8
+	if expected := []int{0, 6, 7, 8, 9, 10, 1, 2, 3}; !reflect.DeepEqual(tree.StableId, expected) {
+		t.Errorf("expected %v; got %v", expected, tree.StableId)
+	}
+	for i, id := range tree.StableId {
+		if label := tree.Label[i]; label != original.Label[id] {
+			t.Errorf("node %d with StableId %d has unexpected label %q", i, id, label)
+		}
+	}
+}
+
+var stringWithCases = []struct {
+	opts   StringOptions
+	output string
+}{
+	{StringOptions{}, "((S (NP a) (VP b)))"},
+	{StringOptions{Separator: "  "}, "((S  (NP  a)  (VP  b)))"},
+	{StringOptions{Separator: "\t", TrailingNewline: true}, "((S\t(NP\ta)\t(VP\tb)))\n"},
+}
+
+func TestParseTreeStringWith(t *testing.T) {
+	tree := FromString("((S (NP a) (VP b)))")
+	for _, c := range stringWithCases {
+		if s := tree.StringWith(c.opts); s != c.output {
+			t.Errorf("expected %q; got %q with %+v", c.output, s, c.opts)
+		}
+	}
+	if s := FromString("(())").StringWith(StringOptions{TrailingNewline: true}); s != "(())\n" {
+		t.Errorf("expected %q; got %q", "(())\n", s)
+	}
+
+	tree.Label[2] = "a b"
+	tree.Label[4] = `"`
+	expected := `((S (NP "a b") (VP "\"")))`
+	if s := tree.StringWith(StringOptions{QuoteSpecial: true}); s != expected {
+		t.Errorf("expected %q; got %q", expected, s)
+	}
+}
+
+var bracketedYieldCases = []struct {
+	input, output string
+}{
+	{"(())", ""},
+	{"((NN cat))", "cat"},
+	{"((S (NP (DT the) (NN cat)) (VP (VBZ sleeps))))", "[S [NP the cat] [VP sleeps]]"},
+	{"((S (NP (NNP John)) (VP (V saw) (NP (PRP it)))))", "[S [NP John] [VP saw [NP it]]]"},
+}
+
+func TestParseTreeBracketedYield(t *testing.T) {
+	for _, c := range bracketedYieldCases {
+		if s := FromString(c.input).BracketedYield(); s != c.output {
+			t.Errorf("expected %q; got %q", c.output, s)
+		}
+	}
+}
+
 var fillHeadCases = []struct {
 	input string
 	head  []int
@@ -92,7 +252,7 @@ var fillHeadCases = []struct {
 }
 
 func TestParseTreeFillHead(t *testing.T) {
-	finder := &heads.TableHeadFinder{nil, heads.HEAD_FINAL}
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
 	for _, c := range fillHeadCases {
 		tree := FromString(c.input)
 		tree.FillHead(finder)
@@ -110,7 +270,7 @@ func TestParseTreeFillHead(t *testing.T) {
 }
 
 func TestParseTreeFillHeadLeaf(t *testing.T) {
-	finder := &heads.TableHeadFinder{nil, heads.HEAD_FINAL}
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
 	for _, c := range fillHeadCases {
 		tree := FromString(c.input)
 		tree.FillHead(finder)
@@ -128,6 +288,68 @@ func TestParseTreeFillHeadLeaf(t *testing.T) {
 	}
 }
 
+func TestParseTreeHeadSpine(t *testing.T) {
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
+	for _, c := range fillHeadCases {
+		tree := FromString(c.input)
+		tree.FillHead(finder)
+		tree.FillHeadLeaf()
+		spine := tree.HeadSpine()
+		if tree.Topology.Root == NoNodeId {
+			if len(spine) != 0 {
+				t.Errorf("expected empty spine; got %v", spine)
+			}
+			continue
+		}
+		if last := spine[len(spine)-1]; last != tree.HeadLeaf[tree.Topology.Root] {
+			t.Errorf("expected spine to end at %d; got %d for %q", tree.HeadLeaf[tree.Topology.Root], last, c.input)
+		}
+		depth := 1
+		for node := tree.Topology.Root; !tree.Topology.Leaf(node); depth++ {
+			node = tree.Topology.Children[node][tree.Head[node]]
+		}
+		if len(spine) != depth {
+			t.Errorf("expected spine of length %d; got %v for %q", depth, spine, c.input)
+		}
+	}
+	tree := FromString("((A (B (C D) (E F)) (G H)))")
+	tree.FillHead(finder)
+	if spine := tree.HeadSpine(); !reflect.DeepEqual(spine, []NodeId{0, 6, 7}) {
+		t.Errorf("expected [0 6 7]; got %v", spine)
+	}
+}
+
+func TestParseTreeHeadWord(t *testing.T) {
+	finder := &heads.TableHeadFinder{
+		Table: map[string]*heads.HeadRule{
+			"S":  heads.NewHeadRule(heads.HEAD_FINAL, []string{"VP"}),
+			"VP": heads.NewHeadRule(heads.HEAD_INITIAL, []string{"VBD"}),
+		},
+		Fallback: heads.HEAD_FINAL,
+	}
+	// S:0 NP:1 DT:2 the:3 NN:4 cat:5 VP:6 VBD:7 saw:8 NP:9 it:10
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP it))))")
+	tree.FillHead(finder)
+	tree.FillHeadLeaf()
+	cases := []struct {
+		node NodeId
+		word string
+		ok   bool
+	}{{6, "saw", true}, {0, "saw", true}, {1, "cat", true}, {3, "the", true}, {NoNodeId, "", false}, {11, "", false}}
+	for _, c := range cases {
+		if word, ok := tree.HeadWord(c.node); word != c.word || ok != c.ok {
+			t.Errorf("expected (%q, %v); got (%q, %v) for node %d", c.word, c.ok, word, ok, c.node)
+		}
+	}
+
+	empty := FromString("(())")
+	empty.FillHead(finder)
+	empty.FillHeadLeaf()
+	if word, ok := empty.HeadWord(0); ok {
+		t.Errorf("expected false; got %q for an empty tree", word)
+	}
+}
+
 var fillYieldPOSCases = []struct {
 	input string
 	yield []NodeId
@@ -148,6 +370,106 @@ func TestParseTreeFillYield(t *testing.T) {
 	}
 }
 
+func TestParseTreeLeafIndexMap(t *testing.T) {
+	tree := FromString("((A (B (C D) (E F)) (G H)))")
+	index, leaves := tree.LeafIndexMap()
+	if expected := []NodeId{3, 5, 7}; !reflect.DeepEqual(leaves, expected) {
+		t.Errorf("expected %v; got %v", expected, leaves)
+	}
+	if expected := map[NodeId]int{3: 0, 5: 1, 7: 2}; !reflect.DeepEqual(index, expected) {
+		t.Errorf("expected %v; got %v", expected, index)
+	}
+	if i := index[leaves[2]]; i != 2 {
+		t.Errorf("expected the third leaf at 2; got %d", i)
+	}
+
+	index, leaves = FromString("(())").LeafIndexMap()
+	if len(index) != 0 || len(leaves) != 0 {
+		t.Errorf("expected empty results; got %v and %v", index, leaves)
+	}
+}
+
+func TestParseTreeWords(t *testing.T) {
+	tree := FromString("((S (NP this) (VP (V is) (NP test))))")
+	if expected := []string{"this", "is", "test"}; !reflect.DeepEqual(tree.Words(), expected) {
+		t.Errorf("expected %v; got %v", expected, tree.Words())
+	}
+	if expected := "this is test"; tree.Sentence() != expected {
+		t.Errorf("expected %q; got %q", expected, tree.Sentence())
+	}
+	empty := FromString("(())")
+	if words := empty.Words(); words == nil || len(words) != 0 {
+		t.Errorf("expected an empty slice; got %v", words)
+	}
+	if s := empty.Sentence(); s != "" {
+		t.Errorf("expected an empty string; got %q", s)
+	}
+}
+
+var tagsCases = []struct {
+	input *ParseTree
+	tags  []string
+}{
+	{FromString("(())"), []string{}},
+	{FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat) (PU .))))"), []string{"DT", "NN", "VBD", "PU"}},
+	// (S (NN foo bar) (VB go))
+	{
+		&ParseTree{
+			Topology: fromParents(0, []NodeId{NoNodeId, 0, 1, 1, 0, 4}),
+			Label:    []string{"S", "NN", "foo", "bar", "VB", "go"},
+		},
+		[]string{"", "", "VB"},
+	},
+	// A single leaf.
+	{&ParseTree{Topology: NewRootedTopology(), Label: []string{"a"}}, []string{""}},
+}
+
+func TestParseTreeTags(t *testing.T) {
+	for _, c := range tagsCases {
+		tree := c.input
+		if tags := tree.Tags(); !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("expected %q; got %q for %q", c.tags, tags, tree)
+		}
+		tree.FillPOS()
+		tags := tree.Tags()
+		if !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("expected %q; got %q with POS for %q", c.tags, tags, tree)
+		}
+		if len(tags) != len(tree.Words()) {
+			t.Errorf("expected %d tags; got %d for %q", len(tree.Words()), len(tags), tree)
+		}
+	}
+}
+
+var yieldWordsNoTracesCases = []struct {
+	input string
+	words []string
+}{
+	{"(())", nil},
+	{"((S (NP (DT the) (NN cat)) (VP (VBD sat))))", []string{"the", "cat", "sat"}},
+	{"((SBAR (WHNP-1 (WP what)) (S (NP (PRP I)) (VP (VBD saw) (NP (-NONE- *T*-1))))))", []string{"what", "I", "saw"}},
+	{"((S (NP (-NONE- (NP *PRO*))) (VP (V go))))", []string{"go"}},
+}
+
+func TestParseTreeYieldWordsNoTraces(t *testing.T) {
+	for _, c := range yieldWordsNoTracesCases {
+		tree := FromString(c.input)
+		if words := tree.YieldWordsNoTraces(nil); !reflect.DeepEqual(words, c.words) {
+			t.Errorf("expected %v; got %v for %q", c.words, words, c.input)
+		}
+	}
+	tree := FromString("((S (NP (PRP it)) (VP (VBZ is) (NP (NN 0)))))")
+	words := tree.YieldWordsNoTraces(func(s string) bool { return s == "0" })
+	if expected := []string{"it", "is"}; !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %v; got %v", expected, words)
+	}
+	// Phrasal labels are not tested.
+	words = tree.YieldWordsNoTraces(func(s string) bool { return s == "VP" })
+	if expected := []string{"it", "is", "0"}; !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %v; got %v", expected, words)
+	}
+}
+
 func TestParseTreeFillPOS(t *testing.T) {
 	for _, c := range fillYieldPOSCases {
 		tree := FromString(c.input)
@@ -158,9 +480,43 @@ func TestParseTreeFillPOS(t *testing.T) {
 	}
 }
 
+func TestParseTreeTaggedTokens(t *testing.T) {
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))")
+	expected := []TaggedToken{{"the", "DT"}, {"cat", "NN"}, {"sat", "VBD"}}
+	if tokens := tree.TaggedTokens(); !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("expected %v; got %v", expected, tokens)
+	}
+	if tokens := FromString("(())").TaggedTokens(); len(tokens) != 0 {
+		t.Errorf("expected no tokens; got %v", tokens)
+	}
+}
+
+func TestParseTreeProductionCounts(t *testing.T) {
+	m := bimap.New()
+	tree := FromString("((S (NP (DT the) (NN cat)) (VP (VBD saw) (NP (DT the) (NN dog)))))")
+	counts := tree.ProductionCounts(m)
+	expected := map[string]int{
+		"S -> NP VP": 1, "NP -> DT NN": 2, "DT -> the": 2, "NN -> cat": 1,
+		"VP -> VBD NP": 1, "VBD -> saw": 1, "NN -> dog": 1,
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("expected %d productions; got %d", len(expected), len(counts))
+	}
+	for p, n := range expected {
+		if c := counts[int(m.FindByString(p))]; c != n {
+			t.Errorf("expected %d; got %d for %q", n, c, p)
+		}
+	}
+
+	other := FromString("((S (NP (DT the) (NN cat)) (VP (VBD sat))))").ProductionCounts(m)
+	if c := other[int(m.FindByString("NP -> DT NN"))]; c != 1 {
+		t.Errorf("expected 1; got %d for a shared production", c)
+	}
+}
+
 func TestParseTreeFill(t *testing.T) {
 	flags := []int{0, FILL_LABEL_ID, FILL_SPAN, FILL_HEAD, FILL_HEAD_LEAF, FILL_YIELD, FILL_POS, FILL_UP_LINK, FILL_EVERYTHING}
-	finder := &heads.TableHeadFinder{nil, heads.HEAD_FINAL}
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
 	m := bimap.New()
 
 	tree := FromString("((A (B C) (D E)))")
@@ -217,7 +573,7 @@ var treeTopsortCases = []struct {
 
 func TestParseTreeTopsort(t *testing.T) {
 	m := bimap.New()
-	finder := &heads.TableHeadFinder{nil, heads.HEAD_FINAL}
+	finder := &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL}
 	for _, c := range treeTopsortCases {
 		input, output := c.input, c.output
 		input.Topology.Disconnect(c.remove)
@@ -238,6 +594,101 @@ func TestParseTreeTopsort(t *testing.T) {
 	}
 }
 
+var equalCases = []struct {
+	a, b  string
+	equal bool
+}{
+	{"(())", "(())", true},
+	{"((A (B C) (D E)))", "((A (B C) (D E)))", true},
+	{"((A (B C) (D E)))", "((A (B C) (D F)))", false},
+	{"((A (B C) (D E)))", "((A (B C)))", false},
+	{"((A (B C) (D E)))", "(())", false},
+}
+
+func TestParseTreeCopy(t *testing.T) {
+	input := "((S (NP (DT the) (NN cat)) (VP (VBD sat))))"
+	tree := FromString(input)
+	// UpLink is not copied.
+	tree.Fill(FILL_EVERYTHING&^FILL_UP_LINK, bimap.New(), &heads.TableHeadFinder{Fallback: heads.HEAD_FINAL})
+	tree.AssignStableIds()
+	c := tree.Copy()
+	if !reflect.DeepEqual(c, tree) {
+		t.Errorf("expected %+v; got %+v", tree, c)
+	}
+	if c.Map != tree.Map {
+		t.Errorf("expected Map to be shared")
+	}
+	c.Topology.Disconnect([]bool{false, true, false, false, false, false, false, false, false})
+	c.Label[0] = "X"
+	c.Span[0] = Span{}
+	c.HeadLeaf[0] = NoNodeId
+	if tree.String() != input || tree.Span[0] != (Span{0, 3}) || tree.HeadLeaf[0] == NoNodeId {
+		t.Errorf("expected the original to be untouched; got %q", tree)
+	}
+	if c := (&ParseTree{Topology: NewEmptyTopology()}).Copy(); c.Label != nil || c.Span != nil {
+		t.Errorf("expected nil annotations; got %+v", c)
+	}
+}
+
+func TestParseTreeMapLeaves(t *testing.T) {
+	tree := FromString("((S (NP (NNP John)) (VP (VBD Saw) (NP (CD 1984)))))")
+	tree.Fill(FILL_LABEL_ID, bimap.New(), nil)
+	tree.Lowercase()
+	if expected := "((S (NP (NNP john)) (VP (VBD saw) (NP (CD 1984)))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+	if tree.Id != nil {
+		t.Errorf("expected nil Id; got %v", tree.Id)
+	}
+	tree.MapLeaves(func(word string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return '0'
+			}
+			return r
+		}, word)
+	})
+	if expected := "((S (NP (NNP john)) (VP (VBD saw) (NP (CD 0000)))))"; tree.String() != expected {
+		t.Errorf("expected %q; got %q", expected, tree)
+	}
+}
+
+func TestParseTreeEqualHash(t *testing.T) {
+	for _, c := range equalCases {
+		a, b := FromString(c.a), FromString(c.b)
+		if eq := a.Equal(b); eq != c.equal {
+			t.Errorf("expected %v; got %v for Equal(%q, %q)", c.equal, eq, c.a, c.b)
+		}
+		if c.equal && a.Hash() != b.Hash() {
+			t.Errorf("expected equal hashes for %q", c.a)
+		}
+	}
+}
+
+var equalWithClassifierCases = []struct {
+	a, b  string
+	equal bool
+}{
+	{"((S (NP it) (VP (VBD ran))))", "((S (NP it) (VP (VBD ran))))", true},
+	{"((S (NP it) (VP (VBD ran))))", "((S (PRP it) (VP (VBD ran))))", true},
+	{"((S (NN it) (VP (VBD ran))))", "((S (PRP it) (VP (VBD ran))))", false},
+	{"((S (NP it) (VP (VBD ran))))", "((S (ADVP it) (VP (VBD ran))))", false},
+	{"((S (NP it) (VP (VBD ran))))", "((S (NP it) (ADVP (VBD ran))))", false},
+	{"((S (NP it) (VP (VBD ran))))", "((S (NP it) (VP (VBD run))))", false},
+}
+
+func TestEqualWithClassifier(t *testing.T) {
+	isPOS := func(label string) bool {
+		return label == "PRP" || label == "NN" || label == "VBD"
+	}
+	for _, c := range equalWithClassifierCases {
+		a, b := FromString(c.a), FromString(c.b)
+		if eq := EqualWithClassifier(a, b, isPOS); eq != c.equal {
+			t.Errorf("expected %v; got %v for %q vs %q", c.equal, eq, c.a, c.b)
+		}
+	}
+}
+
 var stripAnnotationCases = []struct{ input, output string }{
 	{"((S (NP this) (VP (V is) (NP (DT a) (NN test)))))",
 		"((S (NP this) (VP (V is) (NP (DT a) (NN test)))))"},
@@ -251,13 +702,22 @@ func TestStripAnnotation(t *testing.T) {
 	for _, c := range stripAnnotationCases {
 		tree0 := FromString(c.input)
 		tree1 := FromString(c.output)
-		(&tree0).StripAnnotation()
+		tree0.StripAnnotation()
 		if !equiv(tree0, tree1) {
-			t.Errorf("expected %q; got %q\n")
+			t.Errorf("expected %q; got %q\n", tree1, tree0)
 		}
 	}
 }
 
+func TestStripAnnotationSep(t *testing.T) {
+	tree0 := FromString("((S (NP#SBJ this-this) (VP|2 (V is) (-NONE- *T*#1))))")
+	tree1 := FromString("((S (NP this-this) (VP|2 (V is) (-NONE- *T*))))")
+	tree0.StripAnnotationSep("#")
+	if !equiv(tree0, tree1) {
+		t.Errorf("expected %q; got %q", tree1, tree0)
+	}
+}
+
 var removeNoneCases = []struct{ input, output *ParseTree }{
 	{FromString("((S (NP this) (VP (V is) (NP (DT a) (NN test)))))"),
 		FromString("((S (NP this) (VP (V is) (NP (DT a) (NN test)))))")},
@@ -270,7 +730,7 @@ func TestRemoveNone(t *testing.T) {
 	for _, c := range removeNoneCases {
 		tree0 := c.input
 		tree1 := c.output
-		(&tree0).RemoveNone()
+		tree0.RemoveNone()
 		if !equiv(tree0, tree1) {
 			t.Errorf("expected %q; got %q\n", tree1, tree0)
 		}